@@ -1,29 +1,39 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/lazylex/messaggio/internal/adapters/http"
 	"github.com/lazylex/messaggio/internal/adapters/kafka"
 	"github.com/lazylex/messaggio/internal/config"
+	"github.com/lazylex/messaggio/internal/health"
 	"github.com/lazylex/messaggio/internal/helpers/constants/various"
 	"github.com/lazylex/messaggio/internal/logger"
 	prometheusMetrics "github.com/lazylex/messaggio/internal/metrics"
+	"github.com/lazylex/messaggio/internal/outbox/file_outbox"
 	naiveOutbox "github.com/lazylex/messaggio/internal/outbox/naive_implementation/record_outbox"
 	"github.com/lazylex/messaggio/internal/outbox/redis_outbox"
+	"github.com/lazylex/messaggio/internal/outbox/redis_stream_outbox"
 	"github.com/lazylex/messaggio/internal/ports/record_outbox"
 	"github.com/redis/go-redis/v9"
+	kafkago "github.com/segmentio/kafka-go"
+	"io"
 	"log/slog"
+	nethttp "net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"runtime"
+	"syscall"
 
 	"github.com/lazylex/messaggio/internal/repository/postgresql"
 	"github.com/lazylex/messaggio/internal/service"
 )
 
 func main() {
-	config.ReadSecretsToEnv(map[string]string{"SECURE_KEY": "secure-key", "DATABASE_PASSWORD": "db-pwd"})
+	config.ReadSecretsToEnv(map[string]string{
+		"SECURE_KEY": "secure-key", "DATABASE_PASSWORD": "db-pwd", "PROFILER_PASSWORD": "profiler-pwd",
+		"KAFKA_SASL_PASSWORD": "kafka-sasl-pwd"})
 	cfg := config.MustLoad()
 
 	slog.SetDefault(logger.MustCreate(cfg.Env, cfg.Instance))
@@ -32,26 +42,118 @@ func main() {
 		clearScreen()
 	}
 
-	repo := postgresql.MustCreate(cfg.PersistentStorage)
-	brokerOutbox, repoOutbox := MustCreateOutboxes(cfg)
+	repo := postgresql.MustCreate(cfg.PersistentStorage, cfg.Instance, cfg.Outbox == various.PostgreSQL)
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	brokerOutbox, repoOutbox, statusOutbox := MustCreateOutboxes(backgroundCtx, cfg)
 
 	metrics := prometheusMetrics.MustCreate(&cfg.Prometheus)
 
-	domainService := service.MustCreate(repo, brokerOutbox, repoOutbox, cfg.Service, metrics.Service)
-	kafka.MustRun(cfg.Kafka, domainService, cfg.Instance)
+	domainService := service.MustCreate(
+		repo, brokerOutbox, repoOutbox, statusOutbox, cfg.Service, cfg.Retry, metrics.Service)
 
-	if err := http.StartServer(domainService, cfg); err != nil {
+	kafkaDialer := kafka.MustCreateDialer(cfg.Kafka)
+	kafkaDone := []<-chan struct{}{
+		kafka.MustRun(backgroundCtx, cfg.Kafka, cfg.Retry, kafkaDialer, domainService, cfg.Instance)}
+	if cfg.Outbox == various.PostgreSQL {
+		kafkaDone = append(kafkaDone,
+			kafka.MustRunRelay(backgroundCtx, cfg.Kafka, cfg.Retry, kafkaDialer, repo, domainService, cfg.Instance))
+	}
+
+	checker := NewHealthChecker(cfg, kafkaDialer, repo, brokerOutbox, repoOutbox, statusOutbox)
+
+	server, err := http.StartServer(domainService, checker, cfg)
+	if err != nil {
 		slog.Error(err.Error())
 		os.Exit(1)
 	}
 
+	var profiler *nethttp.Server
+	if cfg.EnableProfiler {
+		if profiler, err = http.StartProfiler(cfg); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	signal.Notify(c, os.Kill)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	sig := <-c
 	fmt.Println() // так красивее, если вывод логов производится в стандартный терминал
 	slog.Info(fmt.Sprintf("%s signal received. Shutdown started", sig))
+	checker.StartShutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// сначала прекращается прием запросов и дожидается завершение уже принятых, затем сообщения, ожидающие отправки,
+	// передаются в Kafka или сохраняются в outbox, и только после этого закрываются соединения с Kafka и СУБД
+	if err = server.Shutdown(ctx); err != nil {
+		slog.Error(err.Error())
+	}
+
+	if profiler != nil {
+		if err = profiler.Shutdown(ctx); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+
+	stopBackground()
+
+	if err = domainService.Shutdown(ctx); err != nil {
+		slog.Error(err.Error())
+	}
+
+	for _, done := range kafkaDone {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			slog.Error("kafka connections were not closed in time")
+		}
+	}
+
+	for _, outbox := range []record_outbox.Interface{brokerOutbox, repoOutbox, statusOutbox} {
+		if closer, ok := outbox.(io.Closer); ok {
+			if err = closer.Close(); err != nil {
+				slog.Error(err.Error())
+			}
+		}
+	}
+
+	repo.Close()
+	slog.Info("shutdown completed")
+}
+
+// NewHealthChecker возвращает структуру для проверки состояния приложения с зарегистрированными проверками
+// СУБД, Kafka (соединение устанавливается через kafkaDialer), Redis (при использовании outbox'ов various.Redis и
+// various.RedisStreams) и количества записей в outbox'ах.
+func NewHealthChecker(cfg *config.Config, kafkaDialer *kafkago.Dialer, repo *postgresql.PostgreSQL,
+	brokerOutbox, repoOutbox, statusOutbox record_outbox.Interface) *health.Checker {
+	checker := health.New(cfg.HealthCheckTimeout, cfg.ReadinessOutboxLimit)
+
+	checker.AddCheck("postgresql", repo.Ping)
+	checker.AddCheck("kafka", func(ctx context.Context) error { return kafka.Ping(ctx, cfg.Kafka, kafkaDialer) })
+	if pinger, ok := repoOutbox.(health.Pinger); ok {
+		checker.AddCheck("redis", pinger.Ping)
+	}
+
+	checker.AddOutbox("repo_outbox", outboxDepth(repoOutbox))
+	checker.AddOutbox("status_outbox", outboxDepth(statusOutbox))
+	if brokerOutbox != nil {
+		checker.AddOutbox("broker_outbox", outboxDepth(brokerOutbox))
+	}
+	if cfg.Outbox == various.PostgreSQL {
+		checker.AddOutbox("transactional_outbox", repo.PendingOutboxCount)
+	}
+
+	return checker
+}
+
+// outboxDepth возвращает функцию получения количества записей в outbox'е.
+func outboxDepth(outbox record_outbox.Interface) health.Depth {
+	return func(context.Context) (int, error) {
+		return outbox.Len(), nil
+	}
 }
 
 func clearScreen() {
@@ -67,24 +169,42 @@ func clearScreen() {
 	}
 }
 
-// MustCreateOutboxes возвращает outbox'ы для временного сохранения сообщений, не отправленных в Kafka и в СУБД. При
-// неверно заданной конфигурации (указан несуществующий outbox и т.п.) выдает ошибку в лог и прекращает работу
-// приложения.
-func MustCreateOutboxes(cfg *config.Config) (brokerOutbox, repoOutbox record_outbox.Interface) {
+// MustCreateOutboxes возвращает outbox'ы для временного сохранения сообщений, не отправленных в Kafka и в СУБД, и
+// обновлений статусов сообщений, не сохраненных в СУБД. При
+// использовании транзакционного outbox'а (various.PostgreSQL) отправку в Kafka осуществляет relay, поэтому outbox для
+// сообщений, не отправленных в Kafka, не создается (возвращается nil). При неверно заданной конфигурации (указан
+// несуществующий outbox и т.п.) выдает ошибку в лог и прекращает работу приложения. При использовании outbox'ов
+// various.Redis запускается перенос записей outbox'ов остановленных экземпляров приложения, работающий до отмены ctx.
+func MustCreateOutboxes(ctx context.Context, cfg *config.Config) (
+	brokerOutbox, repoOutbox, statusOutbox record_outbox.Interface) {
 	switch cfg.Outbox {
 	case various.Redis:
-		if len(cfg.RedisAddress) == 0 {
-			slog.Error("Redis address is empty")
-			os.Exit(1)
-		}
-
-		redisClient := redis.NewClient(
-			&redis.Options{Addr: cfg.RedisAddress, Username: cfg.RedisUser, Password: cfg.RedisPassword, DB: cfg.RedisDB})
-		brokerOutbox = redis_outbox.MustCreate(redisClient, "brokerOutbox", cfg.Instance)
-		repoOutbox = redis_outbox.MustCreate(redisClient, "repoOutbox", cfg.Instance)
+		redisClient := mustCreateRedisClient(cfg)
+		brokerRedisOutbox := redis_outbox.MustCreate(redisClient, "brokerOutbox", cfg.Instance, cfg.OutboxCapacity)
+		repoRedisOutbox := redis_outbox.MustCreate(redisClient, "repoOutbox", cfg.Instance, cfg.OutboxCapacity)
+		statusRedisOutbox := redis_outbox.MustCreate(redisClient, "statusOutbox", cfg.Instance, cfg.OutboxCapacity)
+		redis_outbox.MustStartTakeover(ctx, redisClient, cfg.Instance, cfg.RedisHeartbeatTTL,
+			brokerRedisOutbox, repoRedisOutbox, statusRedisOutbox)
+		brokerOutbox, repoOutbox, statusOutbox = brokerRedisOutbox, repoRedisOutbox, statusRedisOutbox
+	case various.RedisStreams:
+		redisClient := mustCreateRedisClient(cfg)
+		brokerOutbox = redis_stream_outbox.MustCreate(
+			redisClient, "brokerOutbox", cfg.Instance, cfg.OutboxCapacity, cfg.RedisClaimIdle)
+		repoOutbox = redis_stream_outbox.MustCreate(
+			redisClient, "repoOutbox", cfg.Instance, cfg.OutboxCapacity, cfg.RedisClaimIdle)
+		statusOutbox = redis_stream_outbox.MustCreate(
+			redisClient, "statusOutbox", cfg.Instance, cfg.OutboxCapacity, cfg.RedisClaimIdle)
+	case various.File:
+		brokerOutbox = file_outbox.MustCreate(cfg.OutboxDir, "brokerOutbox", cfg.OutboxCapacity, cfg.OutboxSegmentSize)
+		repoOutbox = file_outbox.MustCreate(cfg.OutboxDir, "repoOutbox", cfg.OutboxCapacity, cfg.OutboxSegmentSize)
+		statusOutbox = file_outbox.MustCreate(cfg.OutboxDir, "statusOutbox", cfg.OutboxCapacity, cfg.OutboxSegmentSize)
 	case various.Naive:
-		brokerOutbox = naiveOutbox.New()
-		repoOutbox = naiveOutbox.New()
+		brokerOutbox = naiveOutbox.New(cfg.OutboxCapacity)
+		repoOutbox = naiveOutbox.New(cfg.OutboxCapacity)
+		statusOutbox = naiveOutbox.New(cfg.OutboxCapacity)
+	case various.PostgreSQL:
+		repoOutbox = naiveOutbox.New(cfg.OutboxCapacity)
+		statusOutbox = naiveOutbox.New(cfg.OutboxCapacity)
 	default:
 		slog.Error("Outbox not set")
 		os.Exit(1)
@@ -92,3 +212,15 @@ func MustCreateOutboxes(cfg *config.Config) (brokerOutbox, repoOutbox record_out
 
 	return
 }
+
+// mustCreateRedisClient возвращает клиент Redis. Если адрес сервера Redis не задан, выдает ошибку в лог и прекращает
+// работу приложения.
+func mustCreateRedisClient(cfg *config.Config) *redis.Client {
+	if len(cfg.RedisAddress) == 0 {
+		slog.Error("Redis address is empty")
+		os.Exit(1)
+	}
+
+	return redis.NewClient(
+		&redis.Options{Addr: cfg.RedisAddress, Username: cfg.RedisUser, Password: cfg.RedisPassword, DB: cfg.RedisDB})
+}
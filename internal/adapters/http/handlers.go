@@ -1,24 +1,61 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/status"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/helpers/cursor"
+	"github.com/lazylex/messaggio/internal/ports/health"
 	srvc "github.com/lazylex/messaggio/internal/ports/service"
 	"io/ioutil"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultListLimit = 50   // Количество сообщений на странице по умолчанию
+	maxListLimit     = 500  // Максимальное количество сообщений на странице
+	maxBatchSize     = 1000 // Максимальное количество сообщений в пакете
+	ndjsonMIME       = "application/x-ndjson"
+
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+
+	routingKeyHeader = "Routing-Key"
+	routingKeyQuery  = "routing_key"
+	maxRoutingKeyLen = 255
 )
 
 // Handler структура для обработки http-запросов.
 type Handler struct {
-	service srvc.Interface // Объект, реализующий логику сервиса
+	service    srvc.Interface   // Объект, реализующий логику сервиса
+	health     health.Interface // Объект, проверяющий состояние приложения
+	retryAfter time.Duration    // Время, через которое клиенту предлагается повторить отклоненный запрос
 }
 
-// NewHandler возвращает структуру с обработчиками http-запросов.
-func NewHandler(domainService srvc.Interface) *Handler {
-	return &Handler{service: domainService}
+// NewHandler возвращает структуру с обработчиками http-запросов. При переполнении outbox'ов клиенту предлагается
+// повторить запрос через retryAfter.
+func NewHandler(domainService srvc.Interface, checker health.Interface, retryAfter time.Duration) *Handler {
+	return &Handler{service: domainService, health: checker, retryAfter: retryAfter}
 }
 
-// ProcessMessage ручка сохранения и отправки сообщения в Kafka. Сообщение - содержимое тела запроса.
+// ProcessMessage ручка сохранения и отправки сообщения в Kafka. Сообщение - содержимое тела запроса. Если в заголовке
+// Idempotency-Key передан ключ идемпотентности, повторный запрос с тем же ключом возвращает идентификатор и статус ранее
+// принятого сообщения без его повторной обработки. Ключ маршрутизации, передаваемый в заголовке Routing-Key или
+// параметре запроса routing_key (заголовок имеет приоритет), используется в качестве ключа сообщения в Kafka, что
+// сохраняет порядок сообщений с одинаковым ключом. Если сервис не может гарантировать доставку сообщения из-за
+// переполнения outbox'ов, сообщение не принимается: возвращается ответ с кодом http.StatusTooManyRequests (не
+// успевает отправка в брокер) или http.StatusServiceUnavailable (недоступна БД) и заголовком Retry-After.
 func (h *Handler) ProcessMessage(c *gin.Context) {
 	var message []byte
 	var err error
@@ -27,13 +64,145 @@ func (h *Handler) ProcessMessage(c *gin.Context) {
 		return
 	}
 
-	id, errSave := h.service.ProcessMessage(c.Request.Context(), message)
-	if errSave == srvc.ErrSavingToRepository {
-		c.JSON(http.StatusProcessing, gin.H{"status": "temporally problem to save", "msg_id": id})
+	idempotencyKey := c.GetHeader(idempotencyKeyHeader)
+	if len(idempotencyKey) > maxIdempotencyKeyLen {
+		c.JSON(http.StatusBadRequest, gin.H{"problem": "idempotency key is too long"})
+		return
+	}
+
+	routingKey := c.GetHeader(routingKeyHeader)
+	if len(routingKey) == 0 {
+		routingKey = c.Query(routingKeyQuery)
+	}
+	if len(routingKey) > maxRoutingKeyLen {
+		c.JSON(http.StatusBadRequest, gin.H{"problem": "routing key is too long"})
+		return
+	}
+
+	if err = c.Request.Context().Err(); err != nil {
+		respondWithError(c, err, "can't save message")
 		return
 	}
 
-	c.JSON(http.StatusProcessing, gin.H{"status": "saved, sent to the broker...", "msg_id": id})
+	id, errSave := h.service.ProcessMessage(c.Request.Context(), message, idempotencyKey, routingKey)
+	switch errSave {
+	case nil:
+		c.JSON(http.StatusProcessing, gin.H{"status": srvc.ResultSaved, "msg_id": id})
+	case srvc.ErrSavingToRepository:
+		c.JSON(http.StatusProcessing, gin.H{"status": srvc.ResultTemporallyNotSaved, "msg_id": id})
+	case srvc.ErrDuplicateRequest:
+		info, err := h.service.MessageInfo(c.Request.Context(), id)
+		if err != nil {
+			slog.Error(err.Error())
+			c.JSON(http.StatusOK, gin.H{"status": srvc.ResultDuplicate, "msg_id": id})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": info.Status, "msg_id": id})
+	case srvc.ErrBrokerOutboxFull:
+		h.reject(c, http.StatusTooManyRequests, errSave)
+	case srvc.ErrRepoOutboxFull:
+		h.reject(c, http.StatusServiceUnavailable, errSave)
+	default:
+		respondWithError(c, errSave, "can't save message")
+	}
+}
+
+// ProcessMessages ручка пакетного сохранения и отправки сообщений в Kafka. Тело запроса - JSON-массив сообщений
+// (строки передаются без кавычек, остальные значения - в виде JSON) или, при заголовке Content-Type
+// application/x-ndjson, сообщения, разделенные переводом строки. Возвращает результат обработки каждого сообщения.
+// Если outbox для отправки в брокер переполнен, пакет не принимается и возвращается ответ с кодом
+// http.StatusTooManyRequests и заголовком Retry-After. Ключ идемпотентности для пакета не поддерживается, поэтому
+// запрос с заголовком Idempotency-Key отклоняется с кодом http.StatusBadRequest, чтобы повтор пакета не приводил
+// незаметно для клиента к повторной обработке сообщений.
+func (h *Handler) ProcessMessages(c *gin.Context) {
+	if len(c.GetHeader(idempotencyKeyHeader)) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"problem": "idempotency key is not supported for batch requests"})
+		return
+	}
+
+	var body []byte
+	var err error
+	if body, err = ioutil.ReadAll(c.Request.Body); err != nil || len(body) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"problem": "can't read messages from body"})
+		return
+	}
+
+	var messages []message.Message
+	if c.ContentType() == ndjsonMIME {
+		messages = splitNDJSON(body)
+	} else if messages, err = splitJSONArray(body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"problem": "body is not a JSON array"})
+		return
+	}
+
+	if len(messages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"problem": "no messages in body"})
+		return
+	}
+
+	if len(messages) > maxBatchSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"problem": "too many messages in batch"})
+		return
+	}
+
+	if err = c.Request.Context().Err(); err != nil {
+		respondWithError(c, err, "can't save messages")
+		return
+	}
+
+	if err = h.service.CheckCapacity(); err != nil {
+		h.reject(c, http.StatusTooManyRequests, err)
+		return
+	}
+
+	c.JSON(http.StatusMultiStatus, gin.H{"results": h.service.ProcessMessages(c.Request.Context(), messages)})
+}
+
+// reject отвечает на запрос, не принятый из-за переполнения outbox'а, кодом code и заголовком Retry-After.
+func (h *Handler) reject(c *gin.Context, code int, err error) {
+	slog.Warn(err.Error())
+	c.Header("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(h.retryAfter.Seconds())))))
+	c.JSON(code, gin.H{"problem": "service is overloaded, retry later"})
+}
+
+// splitNDJSON возвращает сообщения, разделенные в body переводом строки. Пустые строки пропускаются.
+func splitNDJSON(body []byte) []message.Message {
+	var messages []message.Message
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) > 0 {
+			messages = append(messages, line)
+		}
+	}
+
+	return messages
+}
+
+// splitJSONArray возвращает элементы JSON-массива body в качестве сообщений. JSON-строки возвращаются без кавычек и
+// экранирования, null - в виде пустого сообщения.
+func splitJSONArray(body []byte) ([]message.Message, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, err
+	}
+
+	messages := make([]message.Message, 0, len(items))
+	for _, item := range items {
+		switch {
+		case string(item) == "null":
+			messages = append(messages, nil)
+		case strings.HasPrefix(string(item), `"`):
+			var text string
+			if err := json.Unmarshal(item, &text); err != nil {
+				return nil, err
+			}
+			messages = append(messages, message.Message(text))
+		default:
+			messages = append(messages, message.Message(item))
+		}
+	}
+
+	return messages, nil
 }
 
 // Statistic возвращает статистику пришедших/отправленных на временное хранение сообщений.
@@ -46,10 +215,172 @@ func (h *Handler) Statistic(c *gin.Context) {
 func (h *Handler) ProcessedStatistic(c *gin.Context) {
 	statistic, err := h.service.ProcessedCountStatistic(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"problem": "can't get statistic"})
-		slog.Error(err.Error())
+		respondWithError(c, err, "can't get statistic")
 		return
 	}
 
 	c.JSON(http.StatusOK, statistic)
 }
+
+// Liveness возвращает результаты проверок зависимостей и outbox'ов. Ответ всегда имеет код http.StatusOK, так как
+// приложение способно обрабатывать запросы, а недоступность внешних сервисов не устраняется его перезапуском.
+func (h *Handler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, h.health.Report(c.Request.Context()))
+}
+
+// Readiness возвращает результаты проверок зависимостей и outbox'ов. Если экземпляр не готов принимать запросы
+// (недоступна зависимость, переполнен outbox или начато завершение работы), ответ имеет код
+// http.StatusServiceUnavailable.
+func (h *Handler) Readiness(c *gin.Context) {
+	report := h.health.Report(c.Request.Context())
+	if !report.Ready {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// MessageInfo возвращает метаданные и текущий статус сообщения с переданным в пути запроса идентификатором.
+func (h *Handler) MessageInfo(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"problem": "invalid message id"})
+		return
+	}
+
+	info, err := h.service.MessageInfo(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, srvc.ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"problem": "message not found"})
+			return
+		}
+
+		respondWithError(c, err, "can't get message info")
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// Messages возвращает страницу сообщений, удовлетворяющих переданным в параметрах запроса фильтрам: status, instance,
+// created_from, created_to, updated_from, updated_to (время в формате RFC 3339). Размер страницы задается параметром
+// limit, для получения следующей страницы передается параметр cursor из предыдущего ответа.
+func (h *Handler) Messages(c *gin.Context) {
+	filter, err := messageFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"problem": err.Error()})
+		return
+	}
+
+	h.respondWithMessages(c, filter)
+}
+
+// DeadLetters возвращает страницу сообщений в статусе status.DeadLettered. Фильтры и постраничный вывод - как у
+// Messages, параметр status не учитывается.
+func (h *Handler) DeadLetters(c *gin.Context) {
+	filter, err := messageFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"problem": err.Error()})
+		return
+	}
+
+	filter.Status = status.DeadLettered
+	h.respondWithMessages(c, filter)
+}
+
+// RedriveMessage повторно отправляет в брокер сообщение в статусе status.DeadLettered с переданным в пути запроса
+// идентификатором. Сообщение переводится в статус status.Queued, ответ имеет код http.StatusAccepted. Если сообщение
+// находится в другом статусе, возвращается ответ с кодом http.StatusConflict.
+func (h *Handler) RedriveMessage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"problem": "invalid message id"})
+		return
+	}
+
+	if err = h.service.RedriveMessage(c.Request.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, srvc.ErrMessageNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"problem": "message not found"})
+		case errors.Is(err, srvc.ErrNotDeadLettered):
+			c.JSON(http.StatusConflict, gin.H{"problem": "message is not dead-lettered"})
+		default:
+			respondWithError(c, err, "can't redrive message")
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": status.Queued, "msg_id": id})
+}
+
+// respondWithMessages отвечает на запрос страницей сообщений, удовлетворяющих фильтру filter.
+func (h *Handler) respondWithMessages(c *gin.Context, filter dto.MessageFilter) {
+	list, err := h.service.Messages(c.Request.Context(), filter)
+	if err != nil {
+		respondWithError(c, err, "can't get messages")
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// messageFilter формирует фильтр выборки сообщений из параметров запроса. При неверном значении какого-либо параметра
+// возвращает ошибку с его описанием.
+func messageFilter(c *gin.Context) (dto.MessageFilter, error) {
+	var err error
+	filter := dto.MessageFilter{
+		Status:   status.Status(c.Query("status")),
+		Instance: c.Query("instance"),
+		Limit:    defaultListLimit,
+	}
+
+	if len(filter.Status) > 0 && !filter.Status.IsValid() {
+		return dto.MessageFilter{}, errors.New("invalid status")
+	}
+
+	if value := c.Query("limit"); len(value) > 0 {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit < 1 || filter.Limit > maxListLimit {
+			return dto.MessageFilter{}, errors.New("invalid limit")
+		}
+	}
+
+	if value := c.Query("cursor"); len(value) > 0 {
+		var after dto.MessageCursor
+		if after, err = cursor.Decode(value); err != nil {
+			return dto.MessageFilter{}, err
+		}
+		filter.After = &after
+	}
+
+	for param, dst := range map[string]*time.Time{
+		"created_from": &filter.CreatedFrom,
+		"created_to":   &filter.CreatedTo,
+		"updated_from": &filter.UpdatedFrom,
+		"updated_to":   &filter.UpdatedTo,
+	} {
+		if value := c.Query(param); len(value) > 0 {
+			if *dst, err = time.Parse(time.RFC3339, value); err != nil {
+				return dto.MessageFilter{}, errors.New("invalid " + param)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// respondWithError отвечает на запрос, обработка которого завершилась ошибкой err. Если истек срок обработки запроса,
+// возвращается ответ с кодом http.StatusGatewayTimeout, если истекло время выполнения запроса к хранилищу - с кодом
+// http.StatusServiceUnavailable, в остальных случаях - с кодом http.StatusInternalServerError и описанием problem.
+func respondWithError(c *gin.Context, err error, problem string) {
+	slog.Error(err.Error())
+
+	switch {
+	case c.Request.Context().Err() != nil:
+		c.JSON(http.StatusGatewayTimeout, gin.H{"problem": "request timeout exceeded"})
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"problem": "storage timeout exceeded"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"problem": problem})
+	}
+}
@@ -1,15 +1,17 @@
 package http
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/lazylex/messaggio/internal/helpers/constants/prefixes"
 	"github.com/lazylex/messaggio/internal/helpers/constants/various"
+	"github.com/lazylex/messaggio/internal/helpers/tracecontext"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const (
@@ -38,7 +40,7 @@ func NewJWTMiddleware(secret []byte) *MiddlewareJWT {
 func (m *MiddlewareJWT) CheckJWT() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		uri := c.Request.RequestURI
-		if strings.HasPrefix(uri, prefixes.PPROFPrefix) || strings.HasPrefix(uri, "/favicon.ico") {
+		if strings.HasPrefix(uri, "/favicon.ico") {
 			c.Next()
 			return
 		}
@@ -50,7 +52,7 @@ func (m *MiddlewareJWT) CheckJWT() gin.HandlerFunc {
 			notParsedToken = c.GetHeader(header)[len(requestHeaderPrefix):]
 		} else {
 			log.Error("no JWT token find")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "no JWT token find"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "no JWT token find"})
 			return
 		}
 		token, err := jwt.Parse(
@@ -64,22 +66,22 @@ func (m *MiddlewareJWT) CheckJWT() gin.HandlerFunc {
 			jwt.WithValidMethods(validMethods),
 		)
 
-		if !token.Valid {
+		if err != nil || !token.Valid {
 			if errors.Is(err, jwt.ErrTokenMalformed) {
 				log.Warn("not a JWT token in request")
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "not a JWT token in request"})
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "not a JWT token in request"})
 			} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
 				log.Warn("invalid JWT token signature")
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid JWT token signature"})
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid JWT token signature"})
 			} else if errors.Is(err, jwt.ErrTokenExpired) {
 				log.Warn("token expired")
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "token expired"})
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token expired"})
 			} else if errors.Is(err, jwt.ErrTokenNotValidYet) {
 				log.Warn("token not valid yet")
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "token not valid yet"})
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token not valid yet"})
 			} else {
-				log.Warn("couldn't handle this token:", err)
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "couldn't handle this token:"})
+				log.Warn("couldn't handle this token", slog.String("error", err.Error()))
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "couldn't handle this token:"})
 			}
 
 			return
@@ -93,7 +95,30 @@ func (m *MiddlewareJWT) CheckJWT() gin.HandlerFunc {
 		}
 
 		log.Warn(ErrNoExpirationClaims.Error())
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "expiration date of the token is absent"})
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "expiration date of the token is absent"})
 		return
 	}
 }
+
+// RequestTimeout возвращает прослойку, ограничивающую время обработки запроса значением timeout. Срок передается в
+// контексте запроса и учитывается сервисом и хранилищем.
+func RequestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// TraceContext возвращает прослойку, сохраняющую в контексте запроса контекст трассировки из заголовка traceparent.
+// Некорректный заголовок игнорируется, как предписывает W3C Trace Context.
+func TraceContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tc, err := tracecontext.Parse(c.GetHeader(tracecontext.Header)); err == nil {
+			c.Request = c.Request.WithContext(tracecontext.NewContext(c.Request.Context(), tc))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/lazylex/messaggio/internal/config"
+	"github.com/lazylex/messaggio/internal/helpers/constants/prefixes"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+var ErrNoProfilerPassword = errors.New("profiler password is empty")
+
+// StartProfiler запускает в отдельной go-рутине http-сервер с обработчиками net/http/pprof по адресу
+// prefixes.PPROFPrefix на порту cfg.ProfilerPort. Сервер не использует таймауты основного http-сервера, чтобы не
+// ограничивать длительность снятия профиля. Вне локального окружения доступ защищен Basic-аутентификацией с логином
+// cfg.ProfilerLogin и паролем cfg.ProfilerPassword, при пустом пароле возвращается ошибка ErrNoProfilerPassword.
+func StartProfiler(cfg *config.Config) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefixes.PPROFPrefix, pprof.Index)
+	mux.HandleFunc(prefixes.PPROFPrefix+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(prefixes.PPROFPrefix+"profile", pprof.Profile)
+	mux.HandleFunc(prefixes.PPROFPrefix+"symbol", pprof.Symbol)
+	mux.HandleFunc(prefixes.PPROFPrefix+"trace", pprof.Trace)
+
+	var handler http.Handler = mux
+	if cfg.Env != config.EnvironmentLocal {
+		if len(cfg.ProfilerPassword) == 0 {
+			return nil, ErrNoProfilerPassword
+		}
+		handler = basicAuth(mux, cfg.ProfilerLogin, cfg.ProfilerPassword)
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf("%s:%s", cfg.HttpHost, cfg.ProfilerPort),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err = server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error(err.Error())
+		}
+	}()
+
+	slog.Info(fmt.Sprintf("%s%s ready for profiling", server.Addr, prefixes.PPROFPrefix))
+
+	return server, nil
+}
+
+// basicAuth возвращает обработчик, пропускающий к next только запросы с переданными в заголовке Authorization логином
+// login и паролем password. Остальным запросам возвращается ответ с кодом http.StatusUnauthorized.
+func basicAuth(next http.Handler, login, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(login)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+			slog.Warn("unauthorized access to profiler", slog.String("remote", r.RemoteAddr))
+			w.Header().Set("WWW-Authenticate", `Basic realm="pprof"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,30 +1,78 @@
 package http
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net"
+	"net/http"
 
 	"github.com/lazylex/messaggio/internal/config"
+	"github.com/lazylex/messaggio/internal/ports/health"
 	"github.com/lazylex/messaggio/internal/ports/service"
 )
 
-func StartServer(service service.Interface, cfg *config.Config) error {
+// StartServer начинает прием http-запросов в отдельной go-рутине и возвращает сервер, остановить который можно методом
+// Shutdown. Возвращает ошибку, если не удалось занять адрес для прослушивания.
+func StartServer(service service.Interface, checker health.Interface, cfg *config.Config) (*http.Server, error) {
 	if cfg.Env == config.EnvironmentProduction {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	router := gin.Default()
-	handler := NewHandler(service)
+	handler := NewHandler(service, checker, cfg.RetryTimeout)
+	router.Use(TraceContext())
+
+	if cfg.RequestTimeout > 0 {
+		if cfg.WriteTimeout > 0 && cfg.RequestTimeout >= cfg.WriteTimeout {
+			slog.Warn("request timeout is not less than write timeout, timeout responses may not reach clients")
+		}
+		router.Use(RequestTimeout(cfg.RequestTimeout))
+	}
 
 	if cfg.Env != config.EnvironmentLocal {
 		tokenMiddleware := NewJWTMiddleware([]byte(cfg.SecureKey))
 		router.POST("/msg", tokenMiddleware.CheckJWT(), handler.ProcessMessage)
+		router.POST("/msg/batch", tokenMiddleware.CheckJWT(), handler.ProcessMessages)
+		router.GET("/msg", tokenMiddleware.CheckJWT(), handler.Messages)
+		router.GET("/msg/:id", tokenMiddleware.CheckJWT(), handler.MessageInfo)
+		router.GET("/dead-letters", tokenMiddleware.CheckJWT(), handler.DeadLetters)
+		router.POST("/dead-letters/:id/redrive", tokenMiddleware.CheckJWT(), handler.RedriveMessage)
 	} else {
 		router.POST("/msg", handler.ProcessMessage)
+		router.POST("/msg/batch", handler.ProcessMessages)
+		router.GET("/msg", handler.Messages)
+		router.GET("/msg/:id", handler.MessageInfo)
+		router.GET("/dead-letters", handler.DeadLetters)
+		router.POST("/dead-letters/:id/redrive", handler.RedriveMessage)
 	}
 
 	router.GET("/statistic", handler.Statistic)
 	router.GET("/processed-statistic", handler.ProcessedStatistic)
+	router.GET("/healthz", handler.Liveness)
+	router.GET("/readyz", handler.Readiness)
+
+	server := &http.Server{
+		Addr:         fmt.Sprintf("%s:%s", cfg.HttpHost, cfg.HttpPort),
+		Handler:      router,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err = server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error(err.Error())
+		}
+	}()
+
+	slog.Info("http server started", slog.String("address", server.Addr))
 
-	return router.Run(fmt.Sprintf("%s:%s", cfg.HttpHost, cfg.HttpPort))
+	return server, nil
 }
@@ -3,29 +3,47 @@ package status
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"github.com/lazylex/messaggio/internal/adapters/kafka/deadletter"
+	"github.com/lazylex/messaggio/internal/adapters/kafka/record"
 	"github.com/lazylex/messaggio/internal/config"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/status"
 	"github.com/lazylex/messaggio/internal/dto"
-	"github.com/lazylex/messaggio/internal/ports/service"
+	"github.com/lazylex/messaggio/internal/helpers/tracecontext"
+	srvc "github.com/lazylex/messaggio/internal/ports/service"
 	"github.com/segmentio/kafka-go"
 	"log/slog"
+	"time"
 )
 
-// StartInteraction запускает чтение и обработку сообщений из topic. Если instance в сообщении из топика не
-// соответствует переданному в параметре функции, дальнейшая обработка сообщения не производится.
-func StartInteraction(cfg config.Kafka, service service.Interface, instance string) {
+// StartInteraction запускает чтение и обработку сообщений из topic. Если instance в заголовке или теле сообщения из
+// топика не соответствует переданному в параметре функции, дальнейшая обработка сообщения не производится. Контекст
+// трассировки из заголовка traceparent передается сервису в контексте и добавляется к записям лога о подтверждении.
+// Сообщение переводится в статус, соответствующий переданному в подтверждении результату обработки outcome (если
+// результат не передан - в status.Processed), вместе с ним сохраняются код и описание ошибки обработки. Подтверждения
+// с недопустимым переходом статуса отбрасываются, а подтверждения, которые не удалось разобрать или содержащие
+// недопустимый статус, передаются в топик недоставленных сообщений через dl. Если обновить статус в БД не удалось,
+// обновление сохраняется в outbox для последующих попыток. Смещение в топике фиксируется только после обновления
+// статуса в БД, сохранения обновления в outbox или передачи подтверждения в топик недоставленных сообщений, поэтому
+// при ошибке сохранения чтение топика приостанавливается. Чтение прекращается при отмене ctx, после чего закрывается
+// возвращаемый канал. Соединения с брокерами устанавливаются через dialer.
+func StartInteraction(ctx context.Context, cfg config.Kafka, dialer *kafka.Dialer, dl *deadletter.Writer,
+	service srvc.Interface, instance string) <-chan struct{} {
 	var err error
 	var m kafka.Message
 
-	ctx := context.Background()
+	done := make(chan struct{})
 
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  cfg.Brokers,
 		Topic:    cfg.ConfirmTopic,
 		MaxBytes: 10e6,
 		GroupID:  instance,
+		Dialer:   dialer,
 	})
 
 	go func() {
+		defer close(done)
 		defer func(r *kafka.Reader) {
 			if err = r.Close(); err != nil {
 				slog.Warn(err.Error())
@@ -34,13 +52,30 @@ func StartInteraction(cfg config.Kafka, service service.Interface, instance stri
 
 		for {
 			if m, err = r.FetchMessage(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
 				continue
 			}
 
+			if header := record.Header(m, record.HeaderInstance); len(header) > 0 && header != instance {
+				continue
+			}
+
+			msgCtx, log := ctx, slog.Default()
+			if tc, errTrace := tracecontext.Parse(record.Header(m, record.HeaderTraceParent)); errTrace == nil {
+				msgCtx = tracecontext.NewContext(ctx, tc)
+				log = log.With(slog.String("trace_id", tc.TraceIDString()), slog.String("span_id", tc.SpanIDString()))
+			}
+
 			var data dto.InstanceId
 
 			if err = json.Unmarshal(m.Value, &data); err != nil {
-				slog.Warn("error unmarshal JSON")
+				log.Warn("error unmarshal JSON")
+				if !deadLetter(ctx, cfg, dl, m, deadletter.CodeMalformed, err) {
+					return
+				}
+				commit(ctx, r, m)
 				continue
 			}
 
@@ -48,11 +83,81 @@ func StartInteraction(cfg config.Kafka, service service.Interface, instance stri
 				continue
 			}
 
-			if err = service.MarkMessageAsProcessed(ctx, data.ID); err != nil {
-				slog.Warn(err.Error())
-			} else if err = r.CommitMessages(ctx, m); err != nil {
-				slog.Warn(err.Error())
+			outcome := data.Outcome
+			if len(outcome) == 0 {
+				outcome = status.Processed
 			}
+
+			details := dto.StatusDetails{ErrorCode: data.ErrorCode, Reason: data.Reason}
+			if err = service.ConfirmMessage(msgCtx, data.ID, outcome, details); err != nil {
+				log.Warn(err.Error(), slog.String("id", data.ID.String()), slog.String("outcome", string(outcome)))
+				switch {
+				case errors.Is(err, srvc.ErrInvalidStatus):
+					if !deadLetter(ctx, cfg, dl, m, deadletter.CodeInvalidOutcome, err) {
+						return
+					}
+				case !errors.Is(err, srvc.ErrInvalidTransition):
+					update := dto.StatusUpdate{ID: data.ID, Outcome: outcome, Details: details}
+					if !saveStatusUpdate(ctx, cfg, service, update) {
+						return
+					}
+				}
+			}
+
+			log.Debug("confirmation processed", slog.String("id", data.ID.String()),
+				slog.String("outcome", string(outcome)))
+
+			commit(ctx, r, m)
 		}
 	}()
+
+	return done
+}
+
+// commit фиксирует смещение записи m в топике подтверждений.
+func commit(ctx context.Context, r *kafka.Reader, m kafka.Message) {
+	if err := r.CommitMessages(ctx, m); err != nil {
+		slog.Warn(err.Error())
+	}
+}
+
+// deadLetter передает подтверждение m, которое не удалось обработать из-за ошибки cause с кодом code, в топик
+// недоставленных сообщений, повторяя попытки через cfg.KafkaTimeBetweenAttempts, чтобы смещение подтверждения не было
+// зафиксировано раньше, чем оно сохранено. Возвращает false, если ctx отменен раньше, чем подтверждение сохранено.
+func deadLetter(ctx context.Context, cfg config.Kafka, dl *deadletter.Writer, m kafka.Message, code string,
+	cause error) bool {
+	for {
+		err := dl.Record(ctx, m, code, cause)
+		if err == nil {
+			return true
+		}
+
+		slog.Error(err.Error(), slog.Int64("offset", m.Offset))
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(cfg.KafkaTimeBetweenAttempts):
+		}
+	}
+}
+
+// saveStatusUpdate сохраняет обновление статуса в outbox, повторяя попытки через cfg.KafkaTimeBetweenAttempts, чтобы
+// смещение следующих подтверждений не было зафиксировано раньше, чем сохранено это. Возвращает false, если ctx
+// отменен раньше, чем обновление сохранено.
+func saveStatusUpdate(ctx context.Context, cfg config.Kafka, service srvc.Interface, update dto.StatusUpdate) bool {
+	for {
+		err := service.SaveStatusUpdate(update)
+		if err == nil {
+			return true
+		}
+
+		slog.Error(err.Error(), slog.String("id", update.ID.String()))
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(cfg.KafkaTimeBetweenAttempts):
+		}
+	}
 }
@@ -0,0 +1,145 @@
+/*
+Package deadletter: пакет для отправки в топик недоставленных сообщений (dead-letter topic) записей, которые не могут
+быть обработаны: сообщений, которые не удалось записать в топик сообщений, и подтверждений обработки, которые не
+удалось разобрать. Значение записи - исходное содержимое (тело сообщения или значение записи подтверждения), заголовки
+содержат код и описание ошибки, источник записи и время ее передачи в топик недоставленных сообщений.
+*/
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"github.com/lazylex/messaggio/internal/adapters/kafka/record"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/ports/service"
+	"github.com/segmentio/kafka-go"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderErrorCode    = "dlq-error-code"    // Код причины, по которой запись не может быть обработана
+	HeaderError        = "dlq-error"         // Описание ошибки обработки записи
+	HeaderSource       = "dlq-source"        // Источник записи: SourceProducer или SourceConsumer
+	HeaderTopic        = "dlq-topic"         // Топик, в который не удалось записать или из которого прочитана запись
+	HeaderPartition    = "dlq-partition"     // Раздел топика, из которого прочитана запись
+	HeaderOffset       = "dlq-offset"        // Смещение прочитанной записи в разделе топика
+	HeaderDeadLettered = "dlq-dead-lettered" // Время передачи записи в топик недоставленных сообщений (RFC 3339)
+
+	SourceProducer = "producer" // Сообщение, которое не удалось записать в топик сообщений
+	SourceConsumer = "consumer" // Подтверждение обработки, которое не удалось разобрать
+
+	CodeMarshal        = "MARSHAL_FAILED"         // Не удалось сформировать запись сообщения
+	CodeUndeliverable  = "UNDELIVERABLE"          // Брокер отклонил запись сообщения без возможности повтора
+	CodeMalformed      = "MALFORMED_CONFIRMATION" // Не удалось разобрать подтверждение обработки
+	CodeInvalidOutcome = "INVALID_OUTCOME"        // Подтверждение содержит недопустимый результат обработки
+)
+
+// Undeliverable возвращает true, если брокер отклонил запись с ошибкой err без возможности повтора: запись слишком
+// велика или повреждена.
+func Undeliverable(err error) bool {
+	var tooLarge kafka.MessageTooLargeError
+
+	return errors.As(err, &tooLarge) || errors.Is(err, kafka.MessageSizeTooLarge) ||
+		errors.Is(err, kafka.InvalidMessage) || errors.Is(err, kafka.InvalidRecord)
+}
+
+// IndexOf возвращает индекс записи m в messages (записи сравниваются по заголовку record.HeaderMessageID) или -1, если
+// запись не найдена.
+func IndexOf(messages []kafka.Message, m kafka.Message) int {
+	id := record.Header(m, record.HeaderMessageID)
+	for i := range messages {
+		if record.Header(messages[i], record.HeaderMessageID) == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Writer структура для записи в топик недоставленных сообщений.
+type Writer struct {
+	w        *kafka.Writer // Writer топика недоставленных сообщений
+	instance string        // Идентификатор экземпляра приложения
+}
+
+// New возвращает структуру для записи в топик недоставленных сообщений через w (топик задается в w).
+func New(w *kafka.Writer, instance string) *Writer {
+	return &Writer{w: w, instance: instance}
+}
+
+// Message записывает в топик недоставленных сообщений тело сообщения data, которое не удалось записать в топик topic.
+// Ключом записи служит ключ маршрутизации сообщения, заголовки содержат метаданные сообщения (как в record.New) и
+// описание ошибки cause с кодом code.
+func (d *Writer) Message(ctx context.Context, data dto.MessageID, topic, code string, cause error) error {
+	var key []byte
+	if len(data.RoutingKey) > 0 {
+		key = []byte(data.RoutingKey)
+	}
+
+	headers := []kafka.Header{
+		{Key: record.HeaderMessageID, Value: []byte(data.ID.String())},
+		{Key: record.HeaderInstance, Value: []byte(d.instance)},
+		{Key: record.HeaderAttempt, Value: []byte(strconv.Itoa(data.Attempt))},
+	}
+	if len(data.TraceParent) > 0 {
+		headers = append(headers, kafka.Header{Key: record.HeaderTraceParent, Value: []byte(data.TraceParent)})
+	}
+	if !data.CreatedAt.IsZero() {
+		headers = append(headers,
+			kafka.Header{Key: record.HeaderCreatedAt, Value: []byte(data.CreatedAt.UTC().Format(time.RFC3339Nano))})
+	}
+
+	headers = append(headers, d.errorHeaders(SourceProducer, topic, code, cause)...)
+
+	return d.w.WriteMessages(ctx, kafka.Message{Key: key, Value: data.Message, Headers: headers})
+}
+
+// Record записывает в топик недоставленных сообщений прочитанную запись m, которую не удалось обработать. Запись
+// сохраняет исходные ключ, значение и заголовки, к которым добавляются раздел и смещение записи и описание ошибки
+// cause с кодом code.
+func (d *Writer) Record(ctx context.Context, m kafka.Message, code string, cause error) error {
+	headers := make([]kafka.Header, 0, len(m.Headers)+7)
+	headers = append(headers, m.Headers...)
+	headers = append(headers, d.errorHeaders(SourceConsumer, m.Topic, code, cause)...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))})
+
+	return d.w.WriteMessages(ctx, kafka.Message{Key: m.Key, Value: m.Value, Headers: headers})
+}
+
+// Divert передает сообщение data, которое не может быть доставлено в топик topic, в топик недоставленных сообщений и
+// меняет его статус на status.DeadLettered с кодом code и описанием ошибки cause. Сообщение остается в БД, откуда его
+// можно отправить повторно (см. service.Interface.RedriveMessage), поэтому ошибка записи в топик недоставленных
+// сообщений только выводится в лог.
+func (d *Writer) Divert(ctx context.Context, s service.Interface, data dto.MessageID, topic, code string, cause error) {
+	log := slog.With(slog.String("id", data.ID.String()), slog.String("code", code))
+	log.Warn("message dead-lettered: " + cause.Error())
+
+	if err := d.Message(ctx, data, topic, code, cause); err != nil {
+		log.Error(err.Error())
+	}
+
+	details := dto.StatusDetails{ErrorCode: code, Reason: cause.Error()}
+	if err := s.DeadLetterMessage(ctx, data.ID, details); err != nil && !errors.Is(err, service.ErrInvalidTransition) {
+		log.Warn(err.Error())
+	}
+}
+
+// Close закрывает writer топика недоставленных сообщений.
+func (d *Writer) Close() error {
+	return d.w.Close()
+}
+
+// errorHeaders возвращает заголовки с описанием ошибки обработки записи.
+func (d *Writer) errorHeaders(source, topic, code string, cause error) []kafka.Header {
+	return []kafka.Header{
+		{Key: HeaderErrorCode, Value: []byte(code)},
+		{Key: HeaderError, Value: []byte(cause.Error())},
+		{Key: HeaderSource, Value: []byte(source)},
+		{Key: HeaderTopic, Value: []byte(topic)},
+		{Key: HeaderDeadLettered, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	}
+}
@@ -1,16 +1,29 @@
 package kafka
 
 import (
+	"context"
+	"errors"
 	"github.com/lazylex/messaggio/internal/adapters/kafka/consumers/status"
+	"github.com/lazylex/messaggio/internal/adapters/kafka/deadletter"
 	"github.com/lazylex/messaggio/internal/adapters/kafka/producers/message"
+	"github.com/lazylex/messaggio/internal/adapters/kafka/producers/relay"
 	"github.com/lazylex/messaggio/internal/config"
+	"github.com/lazylex/messaggio/internal/helpers/constants/various"
 	"github.com/lazylex/messaggio/internal/ports/service"
+	"github.com/lazylex/messaggio/internal/ports/transactional_outbox"
+	kafkago "github.com/segmentio/kafka-go"
 	"log/slog"
 	"os"
 )
 
-// MustRun запускает опрос/запись в топики Кафки.
-func MustRun(cfg config.Kafka, service service.Interface, instance string) {
+// MustRun запускает опрос/запись в топики Кафки. Чтение топика подтверждений прекращается при отмене ctx, запись в
+// топик сообщений - после закрытия канала сообщений сервиса. Возвращаемый канал закрывается, когда оба процесса
+// завершены и соединения с брокером закрыты. Запись производится cfg.Writers параллельными go-рутинами порциями до
+// cfg.BatchSize сообщений. Задержка после ошибки записи растет согласно retryCfg. Сообщения и подтверждения, которые
+// не могут быть обработаны, передаются в топик cfg.DeadLetterTopic. Соединения с брокерами устанавливаются через
+// dialer.
+func MustRun(ctx context.Context, cfg config.Kafka, retryCfg config.Retry, dialer *kafkago.Dialer,
+	service service.Interface, instance string) <-chan struct{} {
 	if len(cfg.Brokers) == 0 {
 		LogFatal("kafka broker list is empty")
 	}
@@ -20,12 +33,157 @@ func MustRun(cfg config.Kafka, service service.Interface, instance string) {
 	if len(cfg.ConfirmTopic) == 0 {
 		LogFatal("kafka confirm topic name is empty")
 	}
+	if len(cfg.DeadLetterTopic) == 0 {
+		LogFatal("kafka dead letter topic name is empty")
+	}
+	if cfg.Writers < 1 {
+		LogFatal("kafka writers count must be positive")
+	}
+
+	dl := deadletter.New(mustCreateWriter(cfg, dialer, cfg.DeadLetterTopic), instance)
+	statusDone := status.StartInteraction(ctx, cfg, dialer, dl, service, instance)
+	messageWriter := mustCreateWriter(cfg, dialer, cfg.MessageTopic)
+	messageDone := message.StartInteraction(cfg, retryCfg, messageWriter, dl, service, instance)
+
+	return closeWhenDone(dl, statusDone, messageDone)
+}
+
+// MustRunRelay запускает отправку в топик сообщений из транзакционного outbox'а. Отправка прекращается при отмене ctx,
+// после чего закрывается возвращаемый канал. Задержка после ошибки отправки растет согласно retryCfg. Сообщения,
+// которые не могут быть записаны в топик, передаются в топик cfg.DeadLetterTopic. Соединения с брокерами
+// устанавливаются через dialer.
+func MustRunRelay(ctx context.Context, cfg config.Kafka, retryCfg config.Retry, dialer *kafkago.Dialer,
+	outbox transactional_outbox.Interface, service service.Interface, instance string) <-chan struct{} {
+	if cfg.RelayBatchSize < 1 {
+		LogFatal("kafka relay batch size must be positive")
+	}
+	if len(cfg.DeadLetterTopic) == 0 {
+		LogFatal("kafka dead letter topic name is empty")
+	}
+
+	dl := deadletter.New(mustCreateWriter(cfg, dialer, cfg.DeadLetterTopic), instance)
+	messageWriter := mustCreateWriter(cfg, dialer, cfg.MessageTopic)
+	relayDone := relay.StartInteraction(ctx, cfg, retryCfg, messageWriter, dl, outbox, service, instance)
 
-	status.StartInteraction(cfg, service, instance)
-	message.StartInteraction(cfg, service, instance)
+	return closeWhenDone(dl, relayDone)
+}
+
+// closeWhenDone возвращает канал, который закрывается после закрытия всех каналов processes и writer'а топика
+// недоставленных сообщений dl, которым пользуются эти процессы.
+func closeWhenDone(dl *deadletter.Writer, processes ...<-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for _, process := range processes {
+			<-process
+		}
+
+		if err := dl.Close(); err != nil {
+			slog.Error(err.Error())
+		}
+	}()
+
+	return done
+}
+
+// mustCreateWriter возвращает writer топика topic, соединяющийся с брокерами с настройками TLS и SASL dialer'а. Writer
+// объединяет записываемые сообщения в пакеты по разделам топика: пакет отправляется, когда в нем набралось
+// cfg.BatchSize сообщений или через cfg.Linger после добавления первого. Подтверждение записи ожидается согласно
+// cfg.RequiredAcks, пакеты сжимаются алгоритмом cfg.Compression. При неверных настройках выдает ошибку в лог и
+// прекращает работу приложения.
+func mustCreateWriter(cfg config.Kafka, dialer *kafkago.Dialer, topic string) *kafkago.Writer {
+	if cfg.BatchSize < 1 {
+		LogFatal("kafka batch size must be positive")
+	}
+	if cfg.Linger < 0 {
+		LogFatal("kafka linger must not be negative")
+	}
+
+	return &kafkago.Writer{
+		Addr:                   kafkago.TCP(cfg.Brokers...),
+		Transport:              transport(dialer),
+		Topic:                  topic,
+		Balancer:               mustCreateBalancer(cfg),
+		BatchSize:              cfg.BatchSize,
+		BatchTimeout:           cfg.Linger,
+		RequiredAcks:           mustParseRequiredAcks(cfg),
+		Compression:            mustParseCompression(cfg),
+		AllowAutoTopicCreation: true,
+	}
+}
+
+// mustParseRequiredAcks возвращает количество подтверждений записи: various.AcksNone (не ожидать), various.AcksOne
+// (только лидера раздела) или various.AcksAll (всех синхронизированных реплик). При неизвестном значении выдает ошибку
+// в лог и прекращает работу приложения.
+func mustParseRequiredAcks(cfg config.Kafka) kafkago.RequiredAcks {
+	switch cfg.RequiredAcks {
+	case various.AcksNone:
+		return kafkago.RequireNone
+	case various.AcksOne:
+		return kafkago.RequireOne
+	case various.AcksAll:
+		return kafkago.RequireAll
+	default:
+		LogFatal("unknown kafka required acks " + cfg.RequiredAcks)
+		return kafkago.RequireAll
+	}
+}
+
+// mustParseCompression возвращает алгоритм сжатия пакетов сообщений: various.NoCompression, various.GzipCompression,
+// various.SnappyCompression, various.Lz4Compression или various.ZstdCompression. При неизвестном алгоритме выдает
+// ошибку в лог и прекращает работу приложения.
+func mustParseCompression(cfg config.Kafka) kafkago.Compression {
+	switch cfg.Compression {
+	case various.NoCompression:
+		return 0
+	case various.GzipCompression:
+		return kafkago.Gzip
+	case various.SnappyCompression:
+		return kafkago.Snappy
+	case various.Lz4Compression:
+		return kafkago.Lz4
+	case various.ZstdCompression:
+		return kafkago.Zstd
+	default:
+		LogFatal("unknown kafka compression " + cfg.Compression)
+		return 0
+	}
+}
+
+// mustCreateBalancer возвращает балансировщик, распределяющий сообщения по разделам топика по ключу сообщения:
+// various.HashBalancer (FNV-1a, как в kafka-go), various.Murmur2Balancer (совместим с клиентом Kafka для Java) или
+// various.RoundRobinBalancer (ключ не учитывается). Сообщения без ключа распределяются равномерно. При неизвестном
+// балансировщике выдает ошибку в лог и прекращает работу приложения.
+func mustCreateBalancer(cfg config.Kafka) kafkago.Balancer {
+	switch cfg.Balancer {
+	case various.HashBalancer:
+		return &kafkago.Hash{}
+	case various.Murmur2Balancer:
+		return kafkago.Murmur2Balancer{}
+	case various.RoundRobinBalancer:
+		return &kafkago.RoundRobin{}
+	default:
+		LogFatal("unknown kafka balancer " + cfg.Balancer)
+		return nil
+	}
 }
 
 func LogFatal(reason string) {
 	slog.Error(reason)
 	os.Exit(1)
 }
+
+// Ping проверяет доступность брокеров Kafka. Возвращает nil, если удалось установить соединение через dialer хотя бы с
+// одним брокером из cfg.Brokers, иначе - ошибку последней попытки.
+func Ping(ctx context.Context, cfg config.Kafka, dialer *kafkago.Dialer) error {
+	err := errors.New("kafka broker list is empty")
+	for _, broker := range cfg.Brokers {
+		var conn *kafkago.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", broker); err == nil {
+			return conn.Close()
+		}
+	}
+
+	return err
+}
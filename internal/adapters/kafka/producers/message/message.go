@@ -2,68 +2,213 @@ package message
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/adapters/kafka/deadletter"
+	"github.com/lazylex/messaggio/internal/adapters/kafka/record"
 	"github.com/lazylex/messaggio/internal/config"
 	"github.com/lazylex/messaggio/internal/dto"
 	"github.com/lazylex/messaggio/internal/ports/service"
+	"github.com/lazylex/messaggio/internal/retry"
 	"github.com/segmentio/kafka-go"
 	"log/slog"
+	"sync"
 	"time"
 )
 
-var ErrMarshalJson = errors.New("failed to marshal message")
+// StartInteraction запускает cfg.Writers go-рутин, которые отправляют в топик сообщения из канала сервиса через общий
+// writer w. Каждая go-рутина забирает из канала до cfg.BatchSize сообщений (ожидая только первое из них) и записывает
+// их одним вызовом, объединение записей в пакеты по разделам топика с ожиданием до cfg.Linger выполняет w. По
+// результату записи отправленные в брокер сообщения получают статус status.Sent (одним запросом на порцию), не
+// отправленные сохраняются в outbox, а сообщения, которые не могут быть записаны в топик (не удалось
+// сформировать запись или брокер отклонил ее без возможности повтора), передаются в топик недоставленных сообщений
+// через dl. Результаты записи сообщаются предохранителю брокера: пока он разомкнут, сообщения сохраняются в outbox без
+// попытки записи. После ошибки записи go-рутина приостанавливается на время, экспоненциально растущее (начиная с
+// cfg.KafkaTimeBetweenAttempts) с каждой ошибкой подряд, если предохранитель при этом не разомкнулся. Метаданные
+// сообщения и контекст трассировки передаются в заголовках (см. record.New). Отправка прекращается после закрытия
+// канала сервиса и записи оставшихся в нем сообщений, после чего w закрывается и закрывается возвращаемый канал.
+func StartInteraction(cfg config.Kafka, retryCfg config.Retry, w *kafka.Writer, dl *deadletter.Writer,
+	s service.Interface, instance string) <-chan struct{} {
+	breaker := s.BrokerBreaker()
+	ch := s.MessageChan()
 
-func StartInteraction(cfg config.Kafka, s service.Interface, instance string) {
-	var err error
-	var msg []byte
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 
-	w := &kafka.Writer{
-		Addr:                   kafka.TCP(cfg.Brokers...),
-		Topic:                  cfg.MessageTopic,
-		AllowAutoTopicCreation: true,
-	}
+			backoff := retry.NewBackoff(cfg.KafkaTimeBetweenAttempts, retryCfg)
+			failures := 0
 
-	ch := s.MessageChan()
-	go func() {
-		defer func() {
-			if err = w.Close(); err != nil {
-				slog.Error(err.Error())
+			for batch := nextBatch(ch, cfg.BatchSize); len(batch) > 0; batch = nextBatch(ch, cfg.BatchSize) {
+				if !breaker.Allow() {
+					for _, data := range batch {
+						saveUnsent(s, data)
+					}
+					continue
+				}
+
+				handled, err := writeBatch(cfg, w, dl, s, batch, instance)
+				switch {
+				case handled > 0:
+					breaker.Success()
+					failures = 0
+				case err == nil:
+					breaker.Release()
+				default:
+					breaker.Failure()
+					if breaker.State() == retry.Closed {
+						time.Sleep(backoff.Delay(failures))
+					}
+					failures++
+				}
 			}
 		}()
+	}
 
-		for {
-			msgData := <-ch
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wg.Wait()
 
-			data := dto.MessageIdInstance{
-				Message:  msgData.Message,
-				ID:       msgData.ID,
-				Instance: instance,
-			}
+		if err := w.Close(); err != nil {
+			slog.Error(err.Error())
+		}
+	}()
 
-			ctx, cancel := context.WithTimeout(context.Background(), cfg.KafkaWriteTimeout)
+	return done
+}
 
-			if msg, err = json.Marshal(data); err != nil {
-				slog.Error(ErrMarshalJson.Error())
-				cancel()
-				continue
-			}
+// nextBatch возвращает порцию сообщений из ch: первое полученное из ch сообщение и до size-1 сообщений, уже
+// находящихся в буфере ch. После закрытия ch и получения всех сообщений возвращает пустую порцию.
+func nextBatch(ch <-chan dto.MessageID, size int) []dto.MessageID {
+	data, ok := <-ch
+	if !ok {
+		return nil
+	}
 
-			err = w.WriteMessages(ctx, kafka.Message{Value: msg})
-			if err == nil {
-				cancel()
-				continue
+	batch := make([]dto.MessageID, 1, size)
+	batch[0] = data
+	for len(batch) < size {
+		select {
+		case data, ok = <-ch:
+			if !ok {
+				return batch
 			}
+			batch = append(batch, data)
+		default:
+			return batch
+		}
+	}
 
-			slog.Error(err.Error())
+	return batch
+}
 
-			if err = s.SaveUnsentMessage(msgData); err != nil {
-				slog.Error(err.Error())
-			}
+// writeBatch записывает порцию сообщений в топик, меняет статус записанных сообщений на status.Sent и вызывает fail
+// для каждого не записанного сообщения. Возвращает
+// количество сообщений, запись которых брокер обработал (приняв или отклонив без возможности повтора), и ошибку записи.
+// Сообщения, для которых не удалось сформировать запись, передаются в топик недоставленных сообщений и не считаются
+// ошибкой брокера. Если w отказался записывать порцию из-за слишком большого сообщения, это сообщение передается в
+// топик недоставленных сообщений, а остальные записываются повторно.
+func writeBatch(cfg config.Kafka, w *kafka.Writer, dl *deadletter.Writer, s service.Interface, batch []dto.MessageID,
+	instance string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.KafkaWriteTimeout)
+	defer cancel()
 
-			time.Sleep(cfg.KafkaTimeBetweenAttempts)
-			cancel()
+	messages := make([]kafka.Message, 0, len(batch))
+	pending := make([]dto.MessageID, 0, len(batch))
+	for _, data := range batch {
+		msg, err := record.New(data, instance)
+		if err != nil {
+			dl.Divert(ctx, s, data, cfg.MessageTopic, deadletter.CodeMarshal, err)
+			continue
 		}
-	}()
 
+		messages = append(messages, msg)
+		pending = append(pending, data)
+	}
+
+	handled := 0
+	var err error
+	for len(messages) > 0 {
+		err = w.WriteMessages(ctx, messages...)
+
+		var tooLarge kafka.MessageTooLargeError
+		if !errors.As(err, &tooLarge) {
+			break
+		}
+
+		i := deadletter.IndexOf(messages, tooLarge.Message)
+		if i < 0 {
+			break
+		}
+
+		dl.Divert(ctx, s, pending[i], cfg.MessageTopic, deadletter.CodeUndeliverable, err)
+		handled++
+		messages = append(messages[:i], messages[i+1:]...)
+		pending = append(pending[:i], pending[i+1:]...)
+		err = nil
+	}
+
+	var writeErrors kafka.WriteErrors
+	perMessage := errors.As(err, &writeErrors) && len(writeErrors) == len(pending)
+
+	sent := make([]uuid.UUID, 0, len(pending))
+	for i, data := range pending {
+		msgErr := err
+		if perMessage {
+			msgErr = writeErrors[i]
+		}
+
+		if msgErr == nil {
+			sent = append(sent, data.ID)
+		} else {
+			fail(ctx, cfg, dl, s, data, msgErr)
+		}
+
+		if msgErr == nil || deadletter.Undeliverable(msgErr) {
+			handled++
+		}
+	}
+
+	markSent(cfg, s, sent)
+
+	return handled, err
+}
+
+// fail обрабатывает ошибку записи сообщения в топик: если брокер отклонил запись без возможности повтора - передает
+// сообщение в топик недоставленных сообщений, иначе сохраняет сообщение в outbox.
+func fail(ctx context.Context, cfg config.Kafka, dl *deadletter.Writer, s service.Interface, data dto.MessageID,
+	err error) {
+	switch {
+	case deadletter.Undeliverable(err):
+		dl.Divert(ctx, s, data, cfg.MessageTopic, deadletter.CodeUndeliverable, err)
+	default:
+		slog.Error(err.Error(), slog.String("id", data.ID.String()))
+		saveUnsent(s, data)
+	}
+}
+
+// saveUnsent сохраняет в outbox не отправленное в брокер сообщение.
+func saveUnsent(s service.Interface, data dto.MessageID) {
+	if err := s.SaveUnsentMessage(data); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+// markSent одним запросом меняет статус отправленных в брокер сообщений с идентификаторами ids на status.Sent. Запрос
+// выполняется с собственным ограничением времени cfg.KafkaWriteTimeout, так как срок записи порции в топик к этому
+// моменту может почти истечь. Статус сообщений, подтверждение обработки которых уже получено, не меняется.
+func markSent(cfg config.Kafka, s service.Interface, ids []uuid.UUID) {
+	if len(ids) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.KafkaWriteTimeout)
+	defer cancel()
+
+	if err := s.MarkSent(ctx, ids); err != nil {
+		slog.Warn(err.Error(), slog.Int("count", len(ids)))
+	}
 }
@@ -0,0 +1,185 @@
+/*
+Package relay: пакет для отправки в Kafka сообщений из транзакционного outbox'а. Записи outbox'а сохраняются в одной
+транзакции с сообщениями, поэтому сообщение не теряется, даже если приложение завершит работу до его отправки в брокер.
+Запись удаляется из outbox'а только после успешной записи в топик, что обеспечивает доставку "хотя бы один раз".
+Записи экземпляра, завершившего работу аварийно, отправляются другими экземплярами.
+*/
+package relay
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/adapters/kafka/deadletter"
+	"github.com/lazylex/messaggio/internal/adapters/kafka/record"
+	"github.com/lazylex/messaggio/internal/config"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/ports/service"
+	"github.com/lazylex/messaggio/internal/ports/transactional_outbox"
+	"github.com/lazylex/messaggio/internal/retry"
+	"github.com/segmentio/kafka-go"
+	"log/slog"
+	"time"
+)
+
+// StartInteraction запускает go-рутину, которая периодически выбирает из outbox неотправленные записи, отправляет их
+// в топик сообщений, удаляет из outbox'а и меняет статус сообщений на status.Sent. При ошибке отправки повторная
+// попытка производится с задержкой, экспоненциально растущей (начиная с cfg.KafkaTimeBetweenAttempts) с каждой ошибкой
+// подряд. Результаты отправки сообщаются предохранителю брокера, пока он разомкнут, записи не выбираются. Ключ
+// маршрутизации сообщения используется в качестве ключа сообщения Kafka, по которому балансировщик w выбирает раздел
+// топика, метаданные сообщения и контекст трассировки передаются в заголовках (см. record.New). Сообщения, которые не
+// могут быть записаны в топик, передаются в топик недоставленных сообщений через dl, а их записи удаляются из
+// outbox'а. Отправка прекращается при отмене ctx, после чего w закрывается и закрывается возвращаемый канал.
+func StartInteraction(ctx context.Context, cfg config.Kafka, retryCfg config.Retry, w *kafka.Writer,
+	dl *deadletter.Writer, outbox transactional_outbox.Interface, s service.Interface,
+	instance string) <-chan struct{} {
+	breaker := s.BrokerBreaker()
+	backoff := retry.NewBackoff(cfg.KafkaTimeBetweenAttempts, retryCfg)
+	failures := 0
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if err := w.Close(); err != nil {
+				slog.Error(err.Error())
+			}
+		}()
+
+		for ctx.Err() == nil {
+			if !breaker.Allow() {
+				sleep(ctx, cfg.RelayPollInterval)
+				continue
+			}
+
+			sent, err := relayBatch(ctx, cfg, w, dl, outbox, s, instance)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error(err.Error())
+					breaker.Failure()
+				} else {
+					breaker.Release()
+				}
+				sleep(ctx, backoff.Delay(failures))
+				failures++
+				continue
+			}
+
+			breaker.Success()
+			failures = 0
+
+			if sent < cfg.RelayBatchSize {
+				sleep(ctx, cfg.RelayPollInterval)
+			}
+		}
+	}()
+
+	return done
+}
+
+// sleep приостанавливает выполнение на d или до отмены ctx.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// relayBatch закрепляет за экземпляром приложения одну порцию неотправленных записей outbox'а, отправляет их в топик
+// и удаляет из outbox'а. Записи других экземпляров закрепляются, если не выбирались ими дольше cfg.RelayClaimTimeout.
+// Сообщения, для которых не удалось сформировать запись или запись которых брокер отклонил без возможности повтора,
+// передаются в топик недоставленных сообщений. Возвращает количество выбранных из outbox'а записей.
+func relayBatch(ctx context.Context, cfg config.Kafka, w *kafka.Writer, dl *deadletter.Writer,
+	outbox transactional_outbox.Interface, s service.Interface, instance string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.KafkaWriteTimeout)
+	defer cancel()
+
+	records, err := outbox.ClaimOutboxRecords(ctx, cfg.RelayBatchSize, cfg.RelayClaimTimeout)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+
+	messages := make([]kafka.Message, 0, len(records))
+	pending := make([]dto.MessageID, 0, len(records))
+	ids := make([]int64, 0, len(records))
+	for _, outboxRecord := range records {
+		ids = append(ids, outboxRecord.ID)
+
+		var msg kafka.Message
+		if msg, err = record.New(outboxRecord.Data, instance); err != nil {
+			dl.Divert(ctx, s, outboxRecord.Data, cfg.MessageTopic, deadletter.CodeMarshal, err)
+			continue
+		}
+
+		messages = append(messages, msg)
+		pending = append(pending, outboxRecord.Data)
+	}
+
+	for len(messages) > 0 {
+		err = w.WriteMessages(ctx, messages...)
+
+		var tooLarge kafka.MessageTooLargeError
+		if !errors.As(err, &tooLarge) {
+			break
+		}
+
+		i := deadletter.IndexOf(messages, tooLarge.Message)
+		if i < 0 {
+			return 0, err
+		}
+
+		dl.Divert(ctx, s, pending[i], cfg.MessageTopic, deadletter.CodeUndeliverable, err)
+		messages = append(messages[:i], messages[i+1:]...)
+		pending = append(pending[:i], pending[i+1:]...)
+		err = nil
+	}
+
+	sent := pending
+	if err != nil {
+		// порция отправляется повторно целиком, если брокер отклонил без возможности повтора не все не записанные
+		// сообщения
+		var writeErrors kafka.WriteErrors
+		if !errors.As(err, &writeErrors) || len(writeErrors) != len(pending) {
+			return 0, err
+		}
+
+		for _, writeErr := range writeErrors {
+			if writeErr != nil && !deadletter.Undeliverable(writeErr) {
+				return 0, err
+			}
+		}
+
+		sent = make([]dto.MessageID, 0, len(pending))
+		for i, writeErr := range writeErrors {
+			if writeErr == nil {
+				sent = append(sent, pending[i])
+				continue
+			}
+
+			dl.Divert(ctx, s, pending[i], cfg.MessageTopic, deadletter.CodeUndeliverable, writeErr)
+		}
+	}
+
+	if err = outbox.DeleteOutboxRecords(ctx, ids); err != nil {
+		return 0, err
+	}
+
+	sentIDs := make([]uuid.UUID, 0, len(sent))
+	for _, data := range sent {
+		sentIDs = append(sentIDs, data.ID)
+	}
+
+	// срок ctx к этому моменту может почти истечь за время записи порции в топик, поэтому статусы обновляются с
+	// собственным ограничением времени
+	statusCtx, statusCancel := context.WithTimeout(context.Background(), cfg.KafkaWriteTimeout)
+	defer statusCancel()
+
+	if err = s.MarkSent(statusCtx, sentIDs); err != nil {
+		slog.Warn(err.Error(), slog.Int("count", len(sentIDs)))
+	}
+
+	return len(records), nil
+}
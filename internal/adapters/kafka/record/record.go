@@ -0,0 +1,75 @@
+/*
+Package record: пакет для формирования записей, отправляемых в топик сообщений, и чтения заголовков записей Kafka.
+Значение записи - JSON с сообщением, его идентификатором и экземпляром приложения (dto.MessageIdInstance), ключ -
+ключ маршрутизации сообщения. Заголовки дублируют метаданные сообщения, чтобы получатели могли маршрутизировать записи
+без разбора тела, и содержат контекст трассировки W3C (traceparent).
+*/
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/helpers/tracecontext"
+	"github.com/segmentio/kafka-go"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderMessageID   = "message-id"        // Идентификатор сообщения
+	HeaderInstance    = "instance"          // Экземпляр приложения, принявший сообщение
+	HeaderContentType = "content-type"      // Тип содержимого значения записи
+	HeaderCreatedAt   = "created-at"        // Время приема сообщения в формате RFC 3339
+	HeaderAttempt     = "attempt"           // Номер повторной отправки сообщения (0 - первая отправка)
+	HeaderTraceParent = tracecontext.Header // Контекст трассировки W3C
+
+	contentType = "application/json"
+)
+
+var ErrMarshalJson = errors.New("failed to marshal message")
+
+// New возвращает запись Kafka для сообщения data, принятого экземпляром приложения instance. Заголовок traceparent
+// содержит новый span в трассировке, переданной клиентом при отправке сообщения, а если она не передана - в
+// трассировке, идентификатор которой совпадает с идентификатором сообщения.
+func New(data dto.MessageID, instance string) (kafka.Message, error) {
+	value, err := json.Marshal(dto.MessageIdInstance{Message: data.Message, ID: data.ID, Instance: instance})
+	if err != nil {
+		return kafka.Message{}, ErrMarshalJson
+	}
+
+	tc, err := tracecontext.Parse(data.TraceParent)
+	if err != nil {
+		tc = tracecontext.New(data.ID)
+	}
+
+	headers := []kafka.Header{
+		{Key: HeaderMessageID, Value: []byte(data.ID.String())},
+		{Key: HeaderInstance, Value: []byte(instance)},
+		{Key: HeaderContentType, Value: []byte(contentType)},
+		{Key: HeaderAttempt, Value: []byte(strconv.Itoa(data.Attempt))},
+		{Key: HeaderTraceParent, Value: []byte(tc.Child().String())},
+	}
+	if !data.CreatedAt.IsZero() {
+		headers = append(headers,
+			kafka.Header{Key: HeaderCreatedAt, Value: []byte(data.CreatedAt.UTC().Format(time.RFC3339Nano))})
+	}
+
+	var key []byte
+	if len(data.RoutingKey) > 0 {
+		key = []byte(data.RoutingKey)
+	}
+
+	return kafka.Message{Key: key, Value: value, Headers: headers}, nil
+}
+
+// Header возвращает значение заголовка key записи m или пустую строку, если заголовка нет.
+func Header(m kafka.Message, key string) string {
+	for _, header := range m.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/lazylex/messaggio/internal/config"
+	"github.com/lazylex/messaggio/internal/helpers/constants/various"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"os"
+	"time"
+)
+
+// MustCreateDialer возвращает dialer, устанавливающий соединения с брокерами с настройками TLS и SASL из cfg.
+// Сертификаты считываются один раз, поэтому dialer создается при запуске приложения и используется для чтения и записи
+// топиков и проверки доступности брокеров. При неверных настройках выдает ошибку в лог и прекращает работу приложения.
+func MustCreateDialer(cfg config.Kafka) *kafkago.Dialer {
+	return &kafkago.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           mustCreateTLSConfig(cfg),
+		SASLMechanism: mustCreateSASLMechanism(cfg),
+	}
+}
+
+// transport возвращает транспорт для записи в топики с настройками TLS и SASL dialer'а.
+func transport(dialer *kafkago.Dialer) *kafkago.Transport {
+	return &kafkago.Transport{
+		TLS:  dialer.TLS,
+		SASL: dialer.SASLMechanism,
+	}
+}
+
+// mustCreateTLSConfig возвращает конфигурацию TLS для соединений с брокерами или nil, если TLS не используется. Если
+// задан cfg.TLSCAFile, сертификаты брокеров проверяются по корневым сертификатам из этого файла (иначе - по системным).
+// Если заданы cfg.TLSCertFile и cfg.TLSKeyFile, брокерам предъявляется клиентский сертификат. При ошибке чтения
+// сертификатов выдает ошибку в лог и прекращает работу приложения.
+func mustCreateTLSConfig(cfg config.Kafka) *tls.Config {
+	if !cfg.TLSEnable {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+
+	if len(cfg.TLSCAFile) > 0 {
+		ca, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			LogFatal(err.Error())
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			LogFatal("no certificates found in kafka CA file " + cfg.TLSCAFile)
+		}
+	}
+
+	if len(cfg.TLSCertFile) > 0 || len(cfg.TLSKeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			LogFatal(err.Error())
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig
+}
+
+// mustCreateSASLMechanism возвращает механизм аутентификации SASL: various.SASLPlain, various.SASLScramSHA256 или
+// various.SASLScramSHA512 с учетными данными из cfg, или nil для various.SASLNone. При неизвестном механизме или
+// пустом имени пользователя выдает ошибку в лог и прекращает работу приложения.
+func mustCreateSASLMechanism(cfg config.Kafka) sasl.Mechanism {
+	if cfg.SASLMechanism == various.SASLNone {
+		return nil
+	}
+
+	if len(cfg.SASLUsername) == 0 {
+		LogFatal("kafka SASL username is empty")
+	}
+
+	var algo scram.Algorithm
+	switch cfg.SASLMechanism {
+	case various.SASLPlain:
+		return plain.Mechanism{Username: cfg.SASLUsername, Password: cfg.SASLPassword}
+	case various.SASLScramSHA256:
+		algo = scram.SHA256
+	case various.SASLScramSHA512:
+		algo = scram.SHA512
+	default:
+		LogFatal("unknown kafka SASL mechanism " + cfg.SASLMechanism)
+	}
+
+	mechanism, err := scram.Mechanism(algo, cfg.SASLUsername, cfg.SASLPassword)
+	if err != nil {
+		LogFatal(err.Error())
+	}
+
+	return mechanism
+}
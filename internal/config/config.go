@@ -12,7 +12,8 @@ Package config: пакет содержит объявления всех стр
 
 2. Config - структура, содержащая все остальные конфигурации
 
-3. Kafka - структура, содержащая названия топиков и брокеры Apache Kafka
+3. Kafka - структура, содержащая названия топиков, брокеры Apache Kafka, параметры записи в топик и настройки
+аутентификации (SASL) и шифрования (TLS) соединений с брокерами
 
 4. PersistentStorage - настройки реляционной СУБД, используемой в качестве постоянного хранилища
 
@@ -24,7 +25,15 @@ Package config: пакет содержит объявления всех стр
 
 8. Prometheus - конфигурация метрик
 
-9. Outbox - используемый для хранения не сохраненных данных метод - Naive (простое сохранение в память) или Redis (в списке Redis)
+9. Outbox - используемый для хранения не сохраненных данных метод - Naive (простое сохранение в память), Redis (в списке Redis),
+RedisStreams (в потоке Redis, общем для всех экземпляров приложения), File (в журнале на локальном диске в каталоге
+OutboxDir) или PostgreSQL (транзакционный outbox в БД для отправки в брокер и сохранение в память для записи в БД)
+
+10. OutboxCapacity - максимальное количество записей в каждом outbox'е (0 - без ограничения). При заполнении outbox'а
+новые сообщения не принимаются
+
+11. Retry - политика повторных попыток (экспоненциальная задержка) и параметры предохранителей (circuit breaker)
+зависимостей
 
 */
 
@@ -53,7 +62,11 @@ type Config struct {
 	Service           `yaml:"service"`
 	Prometheus        `yaml:"prometheus"`
 	Redis             `yaml:"redis"`
+	Retry             `yaml:"retry"`
 	Outbox            string `yaml:"outbox" env-required:"true"`
+	OutboxCapacity    int    `yaml:"outbox_capacity" env:"OUTBOX_CAPACITY" env-default:"100000"`
+	OutboxDir         string `yaml:"outbox_dir" env:"OUTBOX_DIR" env-default:"./.data/outbox"`
+	OutboxSegmentSize int64  `yaml:"outbox_segment_size" env:"OUTBOX_SEGMENT_SIZE" env-default:"67108864"`
 	Instance          string `yaml:"instance" env-required:"true"`
 	Env               string `yaml:"env" env:"ENV" env-required:"true"`
 }
@@ -62,8 +75,27 @@ type Kafka struct {
 	Brokers                  []string      `yaml:"kafka_brokers" env:"KAFKA_BROKERS"`
 	MessageTopic             string        `yaml:"kafka_message_topic" env:"KAFKA_MESSAGE_TOPIC"`
 	ConfirmTopic             string        `yaml:"kafka_confirm_topic" env:"KAFKA_CONFIRM_TOPIC"`
+	DeadLetterTopic          string        `yaml:"kafka_dead_letter_topic" env:"KAFKA_DEAD_LETTER_TOPIC" env-default:"dead-letter-topic"`
 	KafkaWriteTimeout        time.Duration `yaml:"kafka_write_timeout" env:"KAFKA_WRITE_TIMEOUT" env-required:"true"`
 	KafkaTimeBetweenAttempts time.Duration `yaml:"kafka_time_between_attempts" env:"KAFKA_TIME_BETWEEN_ATTEMPTS" env-required:"true"`
+	RelayPollInterval        time.Duration `yaml:"kafka_relay_poll_interval" env:"KAFKA_RELAY_POLL_INTERVAL" env-default:"1s"`
+	RelayBatchSize           int           `yaml:"kafka_relay_batch_size" env:"KAFKA_RELAY_BATCH_SIZE" env-default:"100"`
+	RelayClaimTimeout        time.Duration `yaml:"kafka_relay_claim_timeout" env:"KAFKA_RELAY_CLAIM_TIMEOUT" env-default:"1m"`
+	Balancer                 string        `yaml:"kafka_balancer" env:"KAFKA_BALANCER" env-default:"hash"`
+	BatchSize                int           `yaml:"kafka_batch_size" env:"KAFKA_BATCH_SIZE" env-default:"100"`
+	Linger                   time.Duration `yaml:"kafka_linger" env:"KAFKA_LINGER" env-default:"10ms"`
+	Writers                  int           `yaml:"kafka_writers" env:"KAFKA_WRITERS" env-default:"4"`
+	RequiredAcks             string        `yaml:"kafka_required_acks" env:"KAFKA_REQUIRED_ACKS" env-default:"all"`
+	Compression              string        `yaml:"kafka_compression" env:"KAFKA_COMPRESSION" env-default:"none"`
+	SASLMechanism            string        `yaml:"kafka_sasl_mechanism" env:"KAFKA_SASL_MECHANISM" env-default:"none"`
+	SASLUsername             string        `yaml:"kafka_sasl_username" env:"KAFKA_SASL_USERNAME"`
+	SASLPassword             string        `yaml:"kafka_sasl_password" env:"KAFKA_SASL_PASSWORD"`
+	TLSEnable                bool          `yaml:"kafka_tls" env:"KAFKA_TLS" env-default:"false"`
+	TLSCAFile                string        `yaml:"kafka_tls_ca_file" env:"KAFKA_TLS_CA_FILE"`
+	TLSCertFile              string        `yaml:"kafka_tls_cert_file" env:"KAFKA_TLS_CERT_FILE"`
+	TLSKeyFile               string        `yaml:"kafka_tls_key_file" env:"KAFKA_TLS_KEY_FILE"`
+	TLSServerName            string        `yaml:"kafka_tls_server_name" env:"KAFKA_TLS_SERVER_NAME"`
+	TLSInsecureSkipVerify    bool          `yaml:"kafka_tls_insecure_skip_verify" env:"KAFKA_TLS_INSECURE_SKIP_VERIFY"`
 }
 
 type PersistentStorage struct {
@@ -79,15 +111,20 @@ type PersistentStorage struct {
 }
 
 type HttpServer struct {
-	HttpHost        string        `yaml:"http_host" env:"HTTP_HOST" env-required:"true"`
-	HttpPort        string        `yaml:"http_port" env:"HTTP_PORT" env-required:"true"`
-	ReadTimeout     time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT" env-required:"true"`
-	WriteTimeout    time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT" env-required:"true"`
-	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT" env-required:"true"`
-	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" env-required:"true"`
-	RequestTimeout  time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT" env-required:"true"`
-	EnableProfiler  bool          `yaml:"enable_profiler" env:"ENABLE_PROFILER"`
-	SecureKey       string        `yaml:"secure_key" env:"SECURE_KEY" env-required:"true"`
+	HttpHost             string        `yaml:"http_host" env:"HTTP_HOST" env-required:"true"`
+	HttpPort             string        `yaml:"http_port" env:"HTTP_PORT" env-required:"true"`
+	ReadTimeout          time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT" env-required:"true"`
+	WriteTimeout         time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT" env-required:"true"`
+	IdleTimeout          time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT" env-required:"true"`
+	ShutdownTimeout      time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" env-required:"true"`
+	RequestTimeout       time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT" env-required:"true"`
+	HealthCheckTimeout   time.Duration `yaml:"health_check_timeout" env:"HEALTH_CHECK_TIMEOUT" env-default:"2s"`
+	ReadinessOutboxLimit int           `yaml:"readiness_outbox_limit" env:"READINESS_OUTBOX_LIMIT" env-default:"10000"`
+	EnableProfiler       bool          `yaml:"enable_profiler" env:"ENABLE_PROFILER"`
+	ProfilerPort         string        `yaml:"profiler_port" env:"PROFILER_PORT" env-default:"6060"`
+	ProfilerLogin        string        `yaml:"profiler_login" env:"PROFILER_LOGIN" env-default:"admin"`
+	ProfilerPassword     string        `yaml:"profiler_password" env:"PROFILER_PASSWORD"`
+	SecureKey            string        `yaml:"secure_key" env:"SECURE_KEY" env-required:"true"`
 }
 
 type Prometheus struct {
@@ -96,14 +133,32 @@ type Prometheus struct {
 }
 
 type Redis struct {
-	RedisAddress  string `yaml:"redis_address" env:"REDIS_ADDRESS"`
-	RedisUser     string `yaml:"redis_user" env:"REDIS_USER"`
-	RedisPassword string `yaml:"redis_password" env:"REDIS_PWD"`
-	RedisDB       int    `yaml:"redis_db" env:"REDIS_DB"`
+	RedisAddress      string        `yaml:"redis_address" env:"REDIS_ADDRESS"`
+	RedisUser         string        `yaml:"redis_user" env:"REDIS_USER"`
+	RedisPassword     string        `yaml:"redis_password" env:"REDIS_PWD"`
+	RedisDB           int           `yaml:"redis_db" env:"REDIS_DB"`
+	RedisClaimIdle    time.Duration `yaml:"redis_claim_idle" env:"REDIS_CLAIM_IDLE" env-default:"5m"`
+	RedisHeartbeatTTL time.Duration `yaml:"redis_heartbeat_ttl" env:"REDIS_HEARTBEAT_TTL" env-default:"30s"`
+}
+
+type Retry struct {
+	RetryMaxInterval        time.Duration `yaml:"retry_max_interval" env:"RETRY_MAX_INTERVAL" env-default:"1m"`
+	RetryMultiplier         float64       `yaml:"retry_multiplier" env:"RETRY_MULTIPLIER" env-default:"2"`
+	RetryJitter             float64       `yaml:"retry_jitter" env:"RETRY_JITTER" env-default:"0.2"`
+	BreakerFailureThreshold int           `yaml:"breaker_failure_threshold" env:"BREAKER_FAILURE_THRESHOLD" env-default:"5"`
+	BreakerOpenTimeout      time.Duration `yaml:"breaker_open_timeout" env:"BREAKER_OPEN_TIMEOUT" env-default:"30s"`
+	BreakerHalfOpenProbes   int           `yaml:"breaker_half_open_probes" env:"BREAKER_HALF_OPEN_PROBES" env-default:"1"`
 }
 
 type Service struct {
-	RetryTimeout time.Duration `yaml:"retry_timeout" env:"RETRY_TIMEOUT" env-required:"true"`
+	RetryTimeout      time.Duration `yaml:"retry_timeout" env:"RETRY_TIMEOUT" env-required:"true"`
+	IdempotencyWindow time.Duration `yaml:"idempotency_window" env:"IDEMPOTENCY_WINDOW" env-default:"24h"`
+	SweepInterval     time.Duration `yaml:"sweep_interval" env:"SWEEP_INTERVAL" env-default:"1m"`
+	StuckThreshold    time.Duration `yaml:"stuck_threshold" env:"STUCK_THRESHOLD" env-default:"10m"`
+	MaxResendAttempts int           `yaml:"max_resend_attempts" env:"MAX_RESEND_ATTEMPTS" env-default:"5"`
+	SweepBatchSize    int           `yaml:"sweep_batch_size" env:"SWEEP_BATCH_SIZE" env-default:"100"`
+	RetryBatchSize    int           `yaml:"retry_batch_size" env:"RETRY_BATCH_SIZE" env-default:"100"`
+	MessageBufferSize int           `yaml:"message_buffer_size" env:"MESSAGE_BUFFER_SIZE" env-default:"1000"`
 }
 
 // MustLoad возвращает конфигурацию, считанную из файла, путь к которому передан из командной строки по флагу config или
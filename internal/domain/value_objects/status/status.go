@@ -3,6 +3,33 @@ package status
 type Status string
 
 const (
-	InProcessing = Status("InProcessing")
-	Processed    = Status("Processed")
+	InProcessing = Status("InProcessing") // Сообщение принято и сохранено в БД
+	Queued       = Status("Queued")       // Сообщение ожидает повторной отправки в брокер
+	Sent         = Status("Sent")         // Сообщение отправлено в брокер
+	Processed    = Status("Processed")    // Получено подтверждение обработки сообщения
+	Failed       = Status("Failed")       // Обработка сообщения завершилась ошибкой или исчерпаны попытки отправки
+	Rejected     = Status("Rejected")     // Сообщение отклонено получателем
+	Expired      = Status("Expired")      // Истек срок актуальности сообщения
+	DeadLettered = Status("DeadLettered") // Сообщение не доставлено и передано в топик недоставленных сообщений
 )
+
+// All содержит все допустимые статусы сообщений.
+var All = []Status{InProcessing, Queued, Sent, Processed, Failed, Rejected, Expired, DeadLettered}
+
+// Pending содержит статусы сообщений, обработка которых еще не подтверждена получателем.
+var Pending = []Status{InProcessing, Queued, Sent}
+
+// Stuck содержит статусы сообщений, которые считаются зависшими, если не изменяются дольше допустимого времени.
+// Сообщения в статусе Queued ожидают отправки в outbox'е и зависшими не считаются.
+var Stuck = []Status{InProcessing, Sent}
+
+// IsValid возвращает true, если статус является одним из допустимых.
+func (s Status) IsValid() bool {
+	for _, st := range All {
+		if s == st {
+			return true
+		}
+	}
+
+	return false
+}
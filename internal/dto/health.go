@@ -0,0 +1,20 @@
+package dto
+
+type Health struct {
+	Status       string             `json:"status"`       // Итоговое состояние: ok, degraded или shutting_down
+	Ready        bool               `json:"ready"`        // Готовность экземпляра приложения принимать запросы
+	Dependencies []DependencyHealth `json:"dependencies"` // Результаты проверок внешних зависимостей
+	Outboxes     []OutboxDepth      `json:"outboxes"`     // Количество записей в outbox'ах
+}
+
+type DependencyHealth struct {
+	Name      string  `json:"name"`            // Название зависимости
+	LatencyMs float64 `json:"latency_ms"`      // Время выполнения проверки в миллисекундах
+	Error     string  `json:"error,omitempty"` // Ошибка проверки (пустая, если зависимость доступна)
+}
+
+type OutboxDepth struct {
+	Name  string `json:"name"`            // Название outbox'а
+	Depth int    `json:"depth"`           // Количество записей в outbox'е
+	Error string `json:"error,omitempty"` // Ошибка получения количества записей
+}
@@ -2,9 +2,13 @@ package dto
 
 import (
 	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/status"
 )
 
 type InstanceId struct {
-	ID       uuid.UUID `json:"id"`
-	Instance string    `json:"instance"`
+	ID        uuid.UUID     `json:"id"`
+	Instance  string        `json:"instance"`
+	Outcome   status.Status `json:"outcome,omitempty"`    // Результат обработки сообщения получателем (по умолчанию - Processed)
+	ErrorCode string        `json:"error_code,omitempty"` // Код ошибки обработки сообщения
+	Reason    string        `json:"reason,omitempty"`     // Описание причины ошибки обработки сообщения
 }
@@ -0,0 +1,23 @@
+package dto
+
+import (
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/status"
+	"time"
+)
+
+type MessageFilter struct {
+	Status      status.Status  // Статус сообщений (пустое значение - любой статус)
+	Instance    string         // Экземпляр приложения, принявший сообщения (пустое значение - любой экземпляр)
+	CreatedFrom time.Time      // Нижняя граница времени создания (нулевое значение - без ограничения)
+	CreatedTo   time.Time      // Верхняя граница времени создания (нулевое значение - без ограничения)
+	UpdatedFrom time.Time      // Нижняя граница времени изменения (нулевое значение - без ограничения)
+	UpdatedTo   time.Time      // Верхняя граница времени изменения (нулевое значение - без ограничения)
+	After       *MessageCursor // Курсор, после которого начинается выборка (nil - с начала)
+	Limit       int            // Максимальное количество сообщений в выборке
+}
+
+type MessageCursor struct {
+	CreatedAt time.Time // Время создания последнего сообщения на предыдущей странице
+	ID        uuid.UUID // Идентификатор последнего сообщения на предыдущей странице
+}
@@ -3,9 +3,15 @@ package dto
 import (
 	"github.com/google/uuid"
 	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	"time"
 )
 
 type MessageID struct {
-	Message message.Message `json:"message"`
-	ID      uuid.UUID       `json:"id"`
+	Message        message.Message `json:"message"`
+	ID             uuid.UUID       `json:"id"`
+	IdempotencyKey string          `json:"-"` // Ключ идемпотентности, переданный клиентом при отправке сообщения
+	Attempt        int             `json:"-"` // Номер повторной отправки сообщения в брокер (0 - первая отправка)
+	RoutingKey     string          `json:"-"` // Ключ маршрутизации, используемый в качестве ключа сообщения Kafka
+	TraceParent    string          `json:"-"` // Контекст трассировки W3C (traceparent), переданный клиентом
+	CreatedAt      time.Time       `json:"-"` // Время приема сообщения
 }
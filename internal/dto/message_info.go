@@ -0,0 +1,21 @@
+package dto
+
+import (
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/status"
+	"time"
+)
+
+type MessageInfo struct {
+	ID             uuid.UUID     `json:"id"`                   // Идентификатор сообщения
+	Size           int           `json:"size"`                 // Размер сообщения в байтах
+	Status         status.Status `json:"status"`               // Текущий статус сообщения
+	Instance       string        `json:"instance"`             // Экземпляр приложения, принявший сообщение
+	ErrorCode      string        `json:"error_code,omitempty"` // Код ошибки обработки сообщения получателем
+	Reason         string        `json:"reason,omitempty"`     // Описание причины ошибки обработки сообщения
+	CreatedAt      time.Time     `json:"created_at"`           // Время сохранения сообщения в БД
+	UpdatedAt      time.Time     `json:"updated_at"`           // Время последнего изменения записи в БД
+	InRepository   bool          `json:"in_repository"`        // Сообщение сохранено в БД
+	InBrokerOutbox bool          `json:"in_broker_outbox"`     // Сообщение ожидает повторной отправки в брокер
+	InRepoOutbox   bool          `json:"in_repo_outbox"`       // Сообщение ожидает повторного сохранения в БД
+}
@@ -0,0 +1,6 @@
+package dto
+
+type MessageList struct {
+	Messages   []MessageInfo `json:"messages"`              // Сообщения текущей страницы
+	NextCursor string        `json:"next_cursor,omitempty"` // Курсор следующей страницы (пусто, если страница последняя)
+}
@@ -0,0 +1,10 @@
+package dto
+
+import "time"
+
+type MessageMetadata struct {
+	RoutingKey  string    // Ключ маршрутизации, используемый в качестве ключа сообщения Kafka
+	TraceParent string    // Контекст трассировки W3C (traceparent), переданный клиентом
+	CreatedAt   time.Time // Время сохранения сообщения в БД
+	Attempt     int       // Номер повторной отправки сообщения в брокер (0 - первая отправка)
+}
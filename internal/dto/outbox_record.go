@@ -0,0 +1,6 @@
+package dto
+
+type OutboxRecord struct {
+	ID   int64     // Идентификатор записи в транзакционном outbox'е
+	Data MessageID // Сообщение, ожидающее отправки в брокер
+}
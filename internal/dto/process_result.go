@@ -0,0 +1,10 @@
+package dto
+
+import "github.com/google/uuid"
+
+type ProcessResult struct {
+	Index  int           `json:"index"`           // Порядковый номер сообщения в пакете
+	ID     uuid.NullUUID `json:"msg_id"`          // Идентификатор сообщения (null, если сообщение не принято)
+	Status string        `json:"status"`          // Результат обработки сообщения
+	Error  string        `json:"error,omitempty"` // Описание ошибки обработки сообщения
+}
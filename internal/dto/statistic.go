@@ -1,7 +1,13 @@
 package dto
 
 type Statistic struct {
-	Total                      uint64 `json:"total"`                         // Всего пришло сообщений на обработку
-	MessagesSentToOutbox       uint64 `json:"messages_sent_to_outbox"`       // Всего сохранено сообщений в outbox
-	MessagesReturnedFromOutbox uint64 `json:"messages_returned_from_outbox"` // Всего удалось переместить сообщений из outbox в БД
+	Total                      uint64            `json:"total"`                         // Всего пришло сообщений на обработку
+	MessagesSentToOutbox       uint64            `json:"messages_sent_to_outbox"`       // Всего сохранено сообщений в outbox
+	MessagesReturnedFromOutbox uint64            `json:"messages_returned_from_outbox"` // Всего удалось переместить сообщений из outbox в БД
+	MessagesResent             uint64            `json:"messages_resent"`               // Всего повторно отправлено в брокер зависших сообщений
+	StatusesSentToOutbox       uint64            `json:"statuses_sent_to_outbox"`       // Всего сохранено в outbox обновлений статусов, не сохраненных в БД
+	MessagesFailed             uint64            `json:"messages_failed"`               // Всего сообщений переведено в статус Failed
+	MessagesDeadLettered       uint64            `json:"messages_dead_lettered"`        // Всего сообщений переведено в статус DeadLettered
+	MessagesRedriven           uint64            `json:"messages_redriven"`             // Всего повторно отправлено в брокер недоставленных сообщений
+	CircuitBreakers            map[string]string `json:"circuit_breakers"`              // Состояние предохранителей зависимостей
 }
@@ -0,0 +1,6 @@
+package dto
+
+type StatusDetails struct {
+	ErrorCode string `json:"error_code,omitempty"` // Код ошибки обработки сообщения получателем
+	Reason    string `json:"reason,omitempty"`     // Описание причины ошибки обработки сообщения
+}
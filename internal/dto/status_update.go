@@ -0,0 +1,12 @@
+package dto
+
+import (
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/status"
+)
+
+type StatusUpdate struct {
+	ID      uuid.UUID     `json:"id"`      // Идентификатор сообщения
+	Outcome status.Status `json:"outcome"` // Статус, в который переводится сообщение
+	Details StatusDetails `json:"details"` // Код и описание ошибки обработки сообщения получателем
+}
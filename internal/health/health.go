@@ -0,0 +1,140 @@
+/*
+Package health: пакет для проверки состояния экземпляра приложения. Проверяются внешние зависимости (СУБД, Redis,
+Kafka) и количество записей в outbox'ах. Экземпляр не готов принимать запросы, если какая-либо зависимость недоступна,
+в outbox'е накопилось больше допустимого количества записей или начато завершение работы приложения.
+*/
+package health
+
+import (
+	"context"
+	"github.com/lazylex/messaggio/internal/dto"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusDegraded     = "degraded"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check функция проверки доступности зависимости. Возвращает ошибку, если зависимость недоступна.
+type Check func(ctx context.Context) error
+
+// Depth функция, возвращающая количество записей в outbox'е.
+type Depth func(ctx context.Context) (int, error)
+
+// Pinger интерфейс зависимости, доступность которой можно проверить.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type named[T any] struct {
+	name string // Название зависимости или outbox'а
+	f    T      // Функция проверки
+}
+
+type Checker struct {
+	mu           sync.RWMutex
+	checks       []named[Check] // Проверки зависимостей в порядке регистрации
+	depths       []named[Depth] // Функции получения количества записей в outbox'ах в порядке регистрации
+	timeout      time.Duration  // Максимальное время выполнения всех проверок
+	outboxLimit  int            // Количество записей в outbox'е, при превышении которого экземпляр не готов
+	shuttingDown atomic.Bool    // Флаг начала завершения работы приложения
+}
+
+// New возвращает структуру для проверки состояния приложения. Проверки выполняются не дольше timeout, при количестве
+// записей в любом из outbox'ов больше outboxLimit (если он положителен) экземпляр считается не готовым.
+func New(timeout time.Duration, outboxLimit int) *Checker {
+	return &Checker{timeout: timeout, outboxLimit: outboxLimit}
+}
+
+// AddCheck регистрирует проверку доступности зависимости name.
+func (c *Checker) AddCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, named[Check]{name: name, f: check})
+}
+
+// AddOutbox регистрирует функцию получения количества записей в outbox'е name.
+func (c *Checker) AddOutbox(name string, depth Depth) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.depths = append(c.depths, named[Depth]{name: name, f: depth})
+}
+
+// StartShutdown отмечает начало завершения работы приложения. После вызова экземпляр считается не готовым.
+func (c *Checker) StartShutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Report выполняет все зарегистрированные проверки параллельно и возвращает их результаты. Поле Ready равно false,
+// если хотя бы одна зависимость недоступна, в outbox'е больше допустимого количества записей или начато завершение
+// работы.
+func (c *Checker) Report(ctx context.Context) dto.Health {
+	c.mu.RLock()
+	checks, depths := c.checks, c.depths
+	c.mu.RUnlock()
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	result := dto.Health{
+		Status:       StatusOK,
+		Ready:        true,
+		Dependencies: make([]dto.DependencyHealth, len(checks)),
+		Outboxes:     make([]dto.OutboxDepth, len(depths)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := check.f(ctx)
+			result.Dependencies[i] = dto.DependencyHealth{
+				Name:      check.name,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Dependencies[i].Error = err.Error()
+			}
+		}()
+	}
+
+	for i, depth := range depths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, err := depth.f(ctx)
+			result.Outboxes[i] = dto.OutboxDepth{Name: depth.name, Depth: count}
+			if err != nil {
+				result.Outboxes[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, dependency := range result.Dependencies {
+		if len(dependency.Error) > 0 {
+			result.Status, result.Ready = StatusDegraded, false
+		}
+	}
+
+	for _, outbox := range result.Outboxes {
+		if len(outbox.Error) > 0 || (c.outboxLimit > 0 && outbox.Depth > c.outboxLimit) {
+			result.Status, result.Ready = StatusDegraded, false
+		}
+	}
+
+	if c.shuttingDown.Load() {
+		result.Status, result.Ready = StatusShuttingDown, false
+	}
+
+	return result
+}
@@ -4,5 +4,27 @@ const (
 	Origin          = "origin"
 	NonExistentPath = "non-existent"
 	Redis           = "Redis"
+	RedisStreams    = "RedisStreams"
 	Naive           = "Naive"
+	File            = "File"
+	PostgreSQL      = "PostgreSQL"
+
+	HashBalancer       = "hash"
+	Murmur2Balancer    = "murmur2"
+	RoundRobinBalancer = "round_robin"
+
+	AcksNone = "none"
+	AcksOne  = "one"
+	AcksAll  = "all"
+
+	NoCompression     = "none"
+	GzipCompression   = "gzip"
+	SnappyCompression = "snappy"
+	Lz4Compression    = "lz4"
+	ZstdCompression   = "zstd"
+
+	SASLNone        = "none"
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
 )
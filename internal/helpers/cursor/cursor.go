@@ -0,0 +1,52 @@
+/*
+Package cursor: пакет для кодирования и декодирования курсоров постраничной выборки сообщений. Курсор передается
+клиенту в виде непрозрачной строки и содержит время создания и идентификатор последнего сообщения на странице.
+*/
+package cursor
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/dto"
+	"strings"
+	"time"
+)
+
+const separator = "|"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Encode возвращает строковое представление курсора.
+func Encode(c dto.MessageCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.Format(time.RFC3339Nano) + separator + c.ID.String()))
+}
+
+// Decode восстанавливает курсор из строки, полученной функцией Encode. При неверном формате строки возвращает ошибку
+// ErrInvalidCursor.
+func Decode(s string) (dto.MessageCursor, error) {
+	var (
+		result dto.MessageCursor
+		data   []byte
+		err    error
+	)
+
+	if data, err = base64.RawURLEncoding.DecodeString(s); err != nil {
+		return dto.MessageCursor{}, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(data), separator)
+	if len(parts) != 2 {
+		return dto.MessageCursor{}, ErrInvalidCursor
+	}
+
+	if result.CreatedAt, err = time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return dto.MessageCursor{}, ErrInvalidCursor
+	}
+
+	if result.ID, err = uuid.Parse(parts[1]); err != nil {
+		return dto.MessageCursor{}, ErrInvalidCursor
+	}
+
+	return result, nil
+}
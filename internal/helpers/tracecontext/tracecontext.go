@@ -0,0 +1,108 @@
+/*
+Package tracecontext: пакет для работы с контекстом трассировки в формате W3C Trace Context (заголовок traceparent):
+разбор и формирование заголовка, создание дочернего контекста и передача контекста через context.Context.
+*/
+package tracecontext
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	Header  = "traceparent" // Имя заголовка с контекстом трассировки
+	version = "00"          // Поддерживаемая версия формата
+	sampled = 0x01          // Флаг записи трассировки
+)
+
+var ErrInvalidTraceParent = errors.New("invalid traceparent")
+
+type contextKey struct{}
+
+// TraceContext контекст трассировки.
+type TraceContext struct {
+	TraceID [16]byte // Идентификатор трассировки
+	SpanID  [8]byte  // Идентификатор родительского span'а
+	Flags   byte     // Флаги трассировки
+}
+
+// Parse разбирает значение заголовка traceparent. Возвращает ErrInvalidTraceParent, если значение не соответствует
+// формату версии 00 или содержит нулевые идентификаторы.
+func Parse(traceParent string) (TraceContext, error) {
+	var tc TraceContext
+
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) != 4 || parts[0] != version || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 ||
+		strings.ToLower(traceParent) != traceParent {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+
+	var flags [1]byte
+	if _, err := hex.Decode(tc.TraceID[:], []byte(parts[1])); err != nil {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+	if _, err := hex.Decode(tc.SpanID[:], []byte(parts[2])); err != nil {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+	tc.Flags = flags[0]
+
+	if !tc.IsValid() {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+
+	return tc, nil
+}
+
+// New возвращает контекст новой трассировки с идентификатором traceID и случайным идентификатором span'а.
+func New(traceID [16]byte) TraceContext {
+	tc := TraceContext{TraceID: traceID, Flags: sampled}
+	_, _ = rand.Read(tc.SpanID[:])
+
+	return tc
+}
+
+// Child возвращает контекст дочернего span'а: та же трассировка с новым случайным идентификатором span'а.
+func (tc TraceContext) Child() TraceContext {
+	child := New(tc.TraceID)
+	child.Flags = tc.Flags
+
+	return child
+}
+
+// IsValid возвращает true, если идентификаторы трассировки и span'а не нулевые.
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// TraceIDString возвращает идентификатор трассировки в шестнадцатеричном виде.
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// SpanIDString возвращает идентификатор span'а в шестнадцатеричном виде.
+func (tc TraceContext) SpanIDString() string {
+	return hex.EncodeToString(tc.SpanID[:])
+}
+
+// String возвращает значение заголовка traceparent.
+func (tc TraceContext) String() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", version, tc.TraceIDString(), tc.SpanIDString(), tc.Flags)
+}
+
+// NewContext возвращает копию ctx, содержащую контекст трассировки tc.
+func NewContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, tc)
+}
+
+// FromContext возвращает контекст трассировки, сохраненный в ctx функцией NewContext.
+func FromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(contextKey{}).(TraceContext)
+	return tc, ok
+}
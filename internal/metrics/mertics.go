@@ -14,8 +14,10 @@ import (
 )
 
 const (
-	NAMESPACE = "messaggio"
-	PATH      = "path"
+	NAMESPACE  = "messaggio"
+	PATH       = "path"
+	OUTCOME    = "outcome"
+	DEPENDENCY = "dependency"
 )
 
 // Metrics структура, содержащая объекты, реализующие интерфейсы для сбора метрик.
@@ -51,7 +53,8 @@ func MustCreate(cfg *config.Prometheus) *Metrics {
 // registerMetrics заносит метрики в регистр и возвращает их. При неудаче возвращает ошибку.
 func registerMetrics() (*Metrics, error) {
 	var err error
-	var incomingMsgMetric, processedMetric, problemsSavingMetric *prometheus.CounterVec
+	var incomingMsgMetric, processedMetric, problemsSavingMetric, confirmationsMetric *prometheus.CounterVec
+	var breakerStateMetric *prometheus.GaugeVec
 
 	if incomingMsgMetric, err = createIncomingMsgTotalMetric(); err != nil {
 		return nil, err
@@ -65,8 +68,16 @@ func registerMetrics() (*Metrics, error) {
 		return nil, err
 	}
 
+	if confirmationsMetric, err = createConfirmationsTotalMetric(); err != nil {
+		return nil, err
+	}
+
+	if breakerStateMetric, err = createCircuitBreakerStateMetric(); err != nil {
+		return nil, err
+	}
+
 	return &Metrics{
-		&Service{incomingMsgMetric, processedMetric, problemsSavingMetric},
+		&Service{incomingMsgMetric, processedMetric, problemsSavingMetric, confirmationsMetric, breakerStateMetric},
 	}, nil
 }
 
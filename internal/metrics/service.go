@@ -6,6 +6,8 @@ type Service struct {
 	incomingMsgInc     *prometheus.CounterVec
 	processedMsgInc    *prometheus.CounterVec
 	problemsSavingInDB *prometheus.CounterVec
+	confirmations      *prometheus.CounterVec
+	breakerState       *prometheus.GaugeVec
 }
 
 // IncomingMsgInc увеличивает счетчик пришедших по HTTP сообщений.
@@ -23,6 +25,17 @@ func (s *Service) ProblemsSavingInDB() {
 	s.problemsSavingInDB.With(prometheus.Labels{}).Inc()
 }
 
+// ConfirmationInc увеличивает счетчик полученных подтверждений обработки сообщений с результатом outcome.
+func (s *Service) ConfirmationInc(outcome string) {
+	s.confirmations.With(prometheus.Labels{OUTCOME: outcome}).Inc()
+}
+
+// CircuitBreakerState устанавливает состояние предохранителя зависимости dependency (0 - замкнут, 1 - полуоткрыт,
+// 2 - разомкнут).
+func (s *Service) CircuitBreakerState(dependency string, state int) {
+	s.breakerState.With(prometheus.Labels{DEPENDENCY: dependency}).Set(float64(state))
+}
+
 // createIncomingMsgTotalMetric создает и регистрирует метрику incoming_messages_total, являющуюся счетчиком пришедших
 // в обработку сообщений.
 func createIncomingMsgTotalMetric() (*prometheus.CounterVec, error) {
@@ -76,3 +89,35 @@ func createProblemsSavingInDBTotalMetric() (*prometheus.CounterVec, error) {
 
 	return orders, nil
 }
+
+// createConfirmationsTotalMetric создает и регистрирует метрику confirmations_total, являющуюся счетчиком полученных
+// подтверждений обработки сообщений в разрезе результата обработки.
+func createConfirmationsTotalMetric() (*prometheus.CounterVec, error) {
+	var err error
+	orders := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "confirmations_total",
+		Namespace: NAMESPACE,
+		Help:      "Count of received confirmations by outcome",
+	}, []string{OUTCOME})
+	if err = prometheus.Register(orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// createCircuitBreakerStateMetric создает и регистрирует метрику circuit_breaker_state, являющуюся состоянием
+// предохранителя в разрезе зависимостей (0 - замкнут, 1 - полуоткрыт, 2 - разомкнут).
+func createCircuitBreakerStateMetric() (*prometheus.GaugeVec, error) {
+	var err error
+	state := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "circuit_breaker_state",
+		Namespace: NAMESPACE,
+		Help:      "Circuit breaker state by dependency (0 - closed, 1 - half-open, 2 - open)",
+	}, []string{DEPENDENCY})
+	if err = prometheus.Register(state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
@@ -0,0 +1,199 @@
+/*
+Package contract: проверка соблюдения реализациями интерфейса "github.com/lazylex/messaggio/internal/ports/record_outbox"
+общего контракта: записи извлекаются в порядке добавления (FIFO), в том числе при чередовании добавления и извлечения,
+записи, выданные PopBatch, удаляются после Ack и возвращаются в начало очереди после Nack, метаданные сообщений
+сохраняются вместе с записями, а количество записей и признак пустоты outbox'а соответствуют его содержимому.
+*/
+package contract
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/ports/record_outbox"
+	"time"
+)
+
+const recordsCount = 10
+
+// Verify проверяет соблюдение контракта outbox'ом, созданным функцией create. Каждая проверка выполняется на новом
+// пустом outbox'е. Возвращает ошибку с описанием первого найденного нарушения.
+func Verify(create func() record_outbox.Interface) error {
+	checks := []struct {
+		name  string
+		check func(record_outbox.Interface) error
+	}{
+		{"fifo order", fifoOrder},
+		{"interleaved order", interleavedOrder},
+		{"length and emptiness", lengthAndEmptiness},
+		{"batch lease", batchLease},
+	}
+
+	for _, c := range checks {
+		if err := c.check(create()); err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+	}
+
+	return nil
+}
+
+// fifoOrder проверяет, что записи извлекаются в порядке добавления.
+func fifoOrder(outbox record_outbox.Interface) error {
+	records := newRecords(recordsCount)
+	for _, record := range records {
+		if err := outbox.Add(record); err != nil {
+			return err
+		}
+	}
+
+	return popInOrder(outbox, records)
+}
+
+// interleavedOrder проверяет, что записи, добавленные после частичного извлечения, не опережают более старые.
+func interleavedOrder(outbox record_outbox.Interface) error {
+	records := newRecords(recordsCount)
+	half := len(records) / 2
+
+	for _, record := range records[:half] {
+		if err := outbox.Add(record); err != nil {
+			return err
+		}
+	}
+
+	if err := popInOrder(outbox, records[:1]); err != nil {
+		return err
+	}
+
+	for _, record := range records[half:] {
+		if err := outbox.Add(record); err != nil {
+			return err
+		}
+	}
+
+	return popInOrder(outbox, records[1:])
+}
+
+// lengthAndEmptiness проверяет соответствие Len и IsEmpty содержимому outbox'а.
+func lengthAndEmptiness(outbox record_outbox.Interface) error {
+	if !outbox.IsEmpty() || outbox.Len() != 0 {
+		return fmt.Errorf("new outbox is not empty")
+	}
+
+	records := newRecords(recordsCount)
+	for i, record := range records {
+		if err := outbox.Add(record); err != nil {
+			return err
+		}
+		if outbox.Len() != i+1 || outbox.IsEmpty() {
+			return fmt.Errorf("expected %d records, got %d", i+1, outbox.Len())
+		}
+	}
+
+	if err := popInOrder(outbox, records); err != nil {
+		return err
+	}
+
+	if !outbox.IsEmpty() || outbox.Len() != 0 {
+		return fmt.Errorf("outbox is not empty after popping all records")
+	}
+
+	return nil
+}
+
+// batchLease проверяет, что выданные PopBatch записи не выдаются повторно, учитываются в Len, удаляются после Ack и
+// возвращаются в начало очереди в прежнем порядке после Nack.
+func batchLease(outbox record_outbox.Interface) error {
+	records := newRecords(recordsCount)
+	for _, record := range records {
+		if err := outbox.Add(record); err != nil {
+			return err
+		}
+	}
+
+	batch := outbox.PopBatch(4)
+	if err := equal(batch, records[:4]); err != nil {
+		return err
+	}
+
+	if peeked := outbox.Peek(); peeked.ID != records[4].ID {
+		return fmt.Errorf("peek: expected %s, got %s", records[4].ID, peeked.ID)
+	}
+
+	if outbox.Len() != len(records) {
+		return fmt.Errorf("expected %d records including leased, got %d", len(records), outbox.Len())
+	}
+
+	if err := outbox.Ack(batch[0].ID, batch[1].ID); err != nil {
+		return err
+	}
+
+	if err := outbox.Nack(batch[2].ID, batch[3].ID); err != nil {
+		return err
+	}
+
+	if outbox.Len() != len(records)-2 {
+		return fmt.Errorf("expected %d records after ack, got %d", len(records)-2, outbox.Len())
+	}
+
+	if err := equal(outbox.PopBatch(len(records)), records[2:]); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// equal сравнивает записи got и expected.
+func equal(got, expected []dto.MessageID) error {
+	if len(got) != len(expected) {
+		return fmt.Errorf("expected %d records, got %d", len(expected), len(got))
+	}
+
+	for i := range expected {
+		if !same(got[i], expected[i]) {
+			return fmt.Errorf("record %d: expected %s, got %s", i, expected[i].ID, got[i].ID)
+		}
+	}
+
+	return nil
+}
+
+// popInOrder извлекает из outbox'а len(expected) записей и сравнивает их с expected.
+func popInOrder(outbox record_outbox.Interface, expected []dto.MessageID) error {
+	for i, want := range expected {
+		got := outbox.Pop()
+		if !same(got, want) {
+			return fmt.Errorf("record %d: expected %s, got %s", i, want.ID, got.ID)
+		}
+	}
+
+	return nil
+}
+
+// same возвращает true, если идентификаторы, сообщения и метаданные записей got и want совпадают.
+func same(got, want dto.MessageID) bool {
+	return got.ID == want.ID && string(got.Message) == string(want.Message) &&
+		got.IdempotencyKey == want.IdempotencyKey && got.Attempt == want.Attempt && got.RoutingKey == want.RoutingKey &&
+		got.TraceParent == want.TraceParent && got.CreatedAt.Equal(want.CreatedAt)
+}
+
+// newRecords возвращает count записей с уникальными идентификаторами, непустыми сообщениями и заполненными
+// метаданными.
+func newRecords(count int) []dto.MessageID {
+	createdAt := time.Now().UTC()
+	records := make([]dto.MessageID, count)
+	for i := range records {
+		records[i] = dto.MessageID{
+			ID:             uuid.New(),
+			Message:        message.Message(fmt.Sprintf("message %d", i)),
+			IdempotencyKey: fmt.Sprintf("key %d", i),
+			Attempt:        i % 3,
+			RoutingKey:     fmt.Sprintf("route %d", i%2),
+			TraceParent:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			CreatedAt:      createdAt.Add(time.Duration(i) * time.Millisecond),
+		}
+	}
+
+	return records
+}
@@ -0,0 +1,471 @@
+/*
+Package file_outbox: реализация интерфейса "github.com/lazylex/messaggio/internal/ports/record_outbox" на основе
+локального журнала (WAL). Добавление и удаление записей дописываются в конец текущего сегмента журнала, после каждой
+операции файл сбрасывается на диск (fsync), поэтому подтвержденные методом Add записи не теряются при аварийном
+завершении работы приложения.
+
+При превышении размера сегмента создается новый. Сегменты, все записи которых удалены, удаляются с диска; живые записи
+из старых, почти пустых сегментов переносятся в текущий сегмент (компактификация). При создании outbox'а журнал
+читается заново: обрезанная запись в конце последнего сегмента отбрасывается, записи восстанавливаются в порядке их
+добавления. Записи, выданные методом PopBatch и не подтвержденные до завершения работы, восстанавливаются как
+невыданные. Записи извлекаются в порядке добавления (FIFO), возвращенные методом Nack - помещаются в начало очереди.
+*/
+package file_outbox
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/ports/record_outbox"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultSegmentSize = 64 * 1024 * 1024
+	compactionRatio    = 4 // Сегмент переносится, если живых записей в нем не больше 1/compactionRatio от добавленных
+)
+
+type segment struct {
+	num  uint64 // Номер сегмента
+	adds int    // Количество записей, добавленных в сегмент
+	live int    // Количество еще не удаленных записей, актуальная копия которых находится в сегменте
+}
+
+type entry struct {
+	data    dto.MessageID // Запись outbox'а
+	seq     uint64        // Порядковый номер добавления записи
+	segment *segment      // Сегмент, содержащий актуальную копию записи
+}
+
+type FileOutbox struct {
+	mu          sync.Mutex
+	dir         string                 // Каталог сегментов журнала
+	segmentSize int64                  // Размер сегмента, при превышении которого создается новый
+	capacity    int                    // Максимальное количество записей в outbox'е, 0 - без ограничения
+	segments    []*segment             // Сегменты по возрастанию номера, последний - текущий
+	active      *os.File               // Файл текущего сегмента
+	activeSize  int64                  // Размер текущего сегмента
+	entries     map[uuid.UUID]*entry   // Все записи outbox'а, в том числе выданные
+	queue       []*entry               // Невыданные записи в порядке извлечения
+	leased      map[uuid.UUID]struct{} // Выданные методом PopBatch и не подтвержденные записи
+	nextSeq     uint64                 // Порядковый номер следующей добавленной записи
+}
+
+// MustCreate возвращает outbox, хранящий журнал в каталоге dir/name, и восстанавливает записи из существующего
+// журнала. Outbox вмещает не более capacity записей (при capacity равном 0 - без ограничения), размер сегмента журнала -
+// segmentSize байт (при segmentSize не больше 0 - 64 МБ). При ошибке работы с файлами выводит ошибку в лог и прекращает
+// работу приложения.
+func MustCreate(dir, name string, capacity int, segmentSize int64) *FileOutbox {
+	if segmentSize <= 0 {
+		segmentSize = defaultSegmentSize
+	}
+
+	fo := &FileOutbox{
+		dir:         filepath.Join(dir, name),
+		segmentSize: segmentSize,
+		capacity:    capacity,
+		entries:     make(map[uuid.UUID]*entry),
+		leased:      make(map[uuid.UUID]struct{}),
+	}
+
+	if err := fo.recover(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	slog.Info(fmt.Sprintf("file outbox %s restored with %d records", fo.dir, len(fo.entries)))
+
+	return fo
+}
+
+// recover восстанавливает записи из журнала и открывает текущий сегмент для записи.
+func (fo *FileOutbox) recover() error {
+	if err := os.MkdirAll(fo.dir, 0o750); err != nil {
+		return err
+	}
+
+	nums, err := listSegments(fo.dir)
+	if err != nil {
+		return err
+	}
+
+	for i, num := range nums {
+		seg := &segment{num: num}
+		fo.segments = append(fo.segments, seg)
+
+		valid, errRead := readSegment(segmentPath(fo.dir, num), func(record walRecord) { fo.replay(seg, record) })
+		if errRead == nil {
+			continue
+		}
+
+		if !errors.Is(errRead, ErrCorruptedRecord) {
+			return errRead
+		}
+
+		if i != len(nums)-1 {
+			slog.Error(fmt.Sprintf("segment %s is corrupted, rest of the segment skipped", segmentPath(fo.dir, num)))
+			continue
+		}
+
+		slog.Warn(fmt.Sprintf("incomplete record at the end of %s truncated", segmentPath(fo.dir, num)))
+		if err = os.Truncate(segmentPath(fo.dir, num), valid); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range fo.entries {
+		fo.queue = append(fo.queue, e)
+	}
+	sort.Slice(fo.queue, func(i, j int) bool { return fo.queue[i].seq < fo.queue[j].seq })
+
+	if len(fo.segments) == 0 {
+		return fo.rotate()
+	}
+
+	return fo.openActive()
+}
+
+// replay применяет запись журнала из сегмента seg к восстанавливаемому состоянию outbox'а.
+func (fo *FileOutbox) replay(seg *segment, record walRecord) {
+	switch record.op {
+	case opAdd:
+		seg.adds++
+		if e, ok := fo.entries[record.id]; ok {
+			// запись перенесена в более новый сегмент при компактификации
+			e.segment.live--
+			e.segment = seg
+		} else {
+			fo.entries[record.id] = &entry{
+				data:    record_outbox.Unmarshal(record.id, record.message),
+				seq:     record.seq,
+				segment: seg,
+			}
+		}
+		seg.live++
+		fo.nextSeq = max(fo.nextSeq, record.seq+1)
+	case opAck:
+		if e, ok := fo.entries[record.id]; ok {
+			e.segment.live--
+			delete(fo.entries, record.id)
+		}
+	}
+}
+
+// openActive открывает последний сегмент для дозаписи.
+func (fo *FileOutbox) openActive() error {
+	seg := fo.segments[len(fo.segments)-1]
+	file, err := os.OpenFile(segmentPath(fo.dir, seg.num), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	fo.active, fo.activeSize = file, info.Size()
+
+	return nil
+}
+
+// rotate закрывает текущий сегмент, создает новый и проводит компактификацию старых сегментов.
+func (fo *FileOutbox) rotate() error {
+	var num uint64
+	if len(fo.segments) > 0 {
+		num = fo.segments[len(fo.segments)-1].num + 1
+	}
+
+	if fo.active != nil {
+		if err := fo.active.Close(); err != nil {
+			return err
+		}
+		fo.active = nil
+	}
+
+	fo.segments = append(fo.segments, &segment{num: num})
+	if err := fo.openActive(); err != nil {
+		return err
+	}
+
+	if err := syncDir(fo.dir); err != nil {
+		return err
+	}
+
+	return fo.compact()
+}
+
+// compact удаляет старые сегменты без живых записей. Живые записи самого старого сегмента, если их не больше
+// 1/compactionRatio от добавленных в него, предварительно переносятся в текущий сегмент.
+func (fo *FileOutbox) compact() error {
+	var removed bool
+	for len(fo.segments) > 1 {
+		oldest := fo.segments[0]
+		if oldest.live > 0 && oldest.live*compactionRatio > oldest.adds {
+			break
+		}
+
+		if oldest.live > 0 {
+			if err := fo.move(oldest); err != nil {
+				return err
+			}
+		}
+
+		if err := os.Remove(segmentPath(fo.dir, oldest.num)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		fo.segments = fo.segments[1:]
+		removed = true
+	}
+
+	if removed {
+		return syncDir(fo.dir)
+	}
+
+	return nil
+}
+
+// move переносит живые записи сегмента seg в текущий сегмент с сохранением порядковых номеров.
+func (fo *FileOutbox) move(seg *segment) error {
+	var records []walRecord
+	var moved []*entry
+	for _, e := range fo.entries {
+		if e.segment == seg {
+			records = append(records,
+				walRecord{op: opAdd, seq: e.seq, id: e.data.ID, message: record_outbox.Marshal(e.data)})
+			moved = append(moved, e)
+		}
+	}
+
+	if err := fo.append(records...); err != nil {
+		return err
+	}
+
+	active := fo.segments[len(fo.segments)-1]
+	for _, e := range moved {
+		e.segment.live--
+		e.segment = active
+		active.live++
+		active.adds++
+	}
+
+	return nil
+}
+
+// append дописывает записи в текущий сегмент и сбрасывает его на диск.
+func (fo *FileOutbox) append(records ...walRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for _, record := range records {
+		buf = append(buf, record.encode()...)
+	}
+
+	if _, err := fo.active.Write(buf); err != nil {
+		// частично записанные данные удаляются, чтобы последующие записи не оказались после поврежденной
+		if errTruncate := fo.active.Truncate(fo.activeSize); errTruncate != nil {
+			slog.Error(errTruncate.Error())
+		}
+		return err
+	}
+	fo.activeSize += int64(len(buf))
+
+	return fo.active.Sync()
+}
+
+// write дописывает записи в журнал, создавая новый сегмент при превышении размера текущего.
+func (fo *FileOutbox) write(records ...walRecord) error {
+	if fo.activeSize >= fo.segmentSize {
+		if err := fo.rotate(); err != nil {
+			return err
+		}
+	}
+
+	return fo.append(records...)
+}
+
+// Add добавляет запись в конец outbox'а. Запись считается сохраненной после сброса журнала на диск. Если outbox
+// заполнен, возвращает ошибку record_outbox.ErrOutboxFull.
+func (fo *FileOutbox) Add(data dto.MessageID) error {
+	if data.ID == uuid.Nil {
+		return errors.New("data is empty")
+	}
+
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	if fo.capacity > 0 && len(fo.entries) >= fo.capacity {
+		return record_outbox.ErrOutboxFull
+	}
+
+	if _, ok := fo.entries[data.ID]; ok {
+		return nil
+	}
+
+	e := &entry{data: data, seq: fo.nextSeq}
+	record := walRecord{op: opAdd, seq: e.seq, id: data.ID, message: record_outbox.Marshal(data)}
+	if err := fo.write(record); err != nil {
+		return err
+	}
+
+	e.segment = fo.segments[len(fo.segments)-1]
+	e.segment.adds++
+	e.segment.live++
+	fo.nextSeq++
+	fo.entries[data.ID] = e
+	fo.queue = append(fo.queue, e)
+
+	return nil
+}
+
+// Pop извлекает самую старую запись и удаляет ее из журнала. Если outbox пуст, возвращает пустую структуру.
+func (fo *FileOutbox) Pop() dto.MessageID {
+	batch := fo.PopBatch(1)
+	if len(batch) == 0 {
+		return dto.MessageID{}
+	}
+
+	if err := fo.Ack(batch[0].ID); err != nil {
+		slog.Error(err.Error())
+	}
+
+	return batch[0]
+}
+
+// PopBatch выдает не более count самых старых записей. Выданные записи не возвращаются повторно до вызова Nack и
+// удаляются из outbox'а вызовом Ack.
+func (fo *FileOutbox) PopBatch(count int) []dto.MessageID {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	count = min(count, len(fo.queue))
+	if count <= 0 {
+		return nil
+	}
+
+	result := make([]dto.MessageID, 0, count)
+	for _, e := range fo.queue[:count] {
+		fo.leased[e.data.ID] = struct{}{}
+		result = append(result, e.data)
+	}
+	clear(fo.queue[:count])
+	fo.queue = fo.queue[count:]
+
+	return result
+}
+
+// Peek возвращает самую старую невыданную запись без ее извлечения. Если таких записей нет, возвращает пустую
+// структуру.
+func (fo *FileOutbox) Peek() dto.MessageID {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	if len(fo.queue) == 0 {
+		return dto.MessageID{}
+	}
+
+	return fo.queue[0].data
+}
+
+// Ack удаляет из outbox'а выданные методом PopBatch записи с идентификаторами ids.
+func (fo *FileOutbox) Ack(ids ...uuid.UUID) error {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	records := make([]walRecord, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := fo.leased[id]; ok {
+			records = append(records, walRecord{op: opAck, id: id})
+		}
+	}
+
+	if err := fo.write(records...); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		e := fo.entries[record.id]
+		e.segment.live--
+		delete(fo.entries, record.id)
+		delete(fo.leased, record.id)
+	}
+
+	return fo.compact()
+}
+
+// Nack возвращает выданные методом PopBatch записи с идентификаторами ids в начало очереди в порядке их добавления.
+func (fo *FileOutbox) Nack(ids ...uuid.UUID) error {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	returned := make([]*entry, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := fo.leased[id]; ok {
+			returned = append(returned, fo.entries[id])
+			delete(fo.leased, id)
+		}
+	}
+	sort.Slice(returned, func(i, j int) bool { return returned[i].seq < returned[j].seq })
+
+	fo.queue = append(returned, fo.queue...)
+
+	return nil
+}
+
+// IsEmpty возвращает true, если в outbox'е нет записей, в том числе выданных и не подтвержденных.
+func (fo *FileOutbox) IsEmpty() bool {
+	return fo.Len() == 0
+}
+
+// Contains возвращает true, если в outbox'е есть запись с идентификатором id.
+func (fo *FileOutbox) Contains(id uuid.UUID) bool {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	_, ok := fo.entries[id]
+
+	return ok
+}
+
+// Len возвращает количество записей в outbox'е, в том числе выданных и не подтвержденных.
+func (fo *FileOutbox) Len() int {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	return len(fo.entries)
+}
+
+// IsFull возвращает true, если outbox заполнен.
+func (fo *FileOutbox) IsFull() bool {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	return fo.capacity > 0 && len(fo.entries) >= fo.capacity
+}
+
+// Close сбрасывает на диск и закрывает текущий сегмент журнала.
+func (fo *FileOutbox) Close() error {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	if fo.active == nil {
+		return nil
+	}
+
+	if err := fo.active.Sync(); err != nil {
+		return err
+	}
+
+	err := fo.active.Close()
+	fo.active = nil
+
+	return err
+}
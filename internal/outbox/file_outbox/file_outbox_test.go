@@ -0,0 +1,94 @@
+package file_outbox
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/outbox/contract"
+	"github.com/lazylex/messaggio/internal/ports/record_outbox"
+	"testing"
+	"time"
+)
+
+// testSegmentSize размер сегмента, при котором журнал тестового outbox'а занимает несколько сегментов.
+const testSegmentSize = 512
+
+func TestContract(t *testing.T) {
+	create := func() record_outbox.Interface {
+		fo := MustCreate(t.TempDir(), "test", 0, testSegmentSize)
+		t.Cleanup(func() { _ = fo.Close() })
+		return fo
+	}
+
+	if err := contract.Verify(create); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContractAfterRecovery(t *testing.T) {
+	create := func() record_outbox.Interface {
+		dir := t.TempDir()
+		if err := MustCreate(dir, "test", 0, testSegmentSize).Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		fo := MustCreate(dir, "test", 0, testSegmentSize)
+		t.Cleanup(func() { _ = fo.Close() })
+		return fo
+	}
+
+	if err := contract.Verify(create); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	dir := t.TempDir()
+	records := make([]dto.MessageID, 20)
+	for i := range records {
+		records[i] = dto.MessageID{
+			ID:          uuid.New(),
+			Message:     message.Message(fmt.Sprintf("message %d", i)),
+			RoutingKey:  fmt.Sprintf("route %d", i),
+			TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			Attempt:     i % 3,
+			CreatedAt:   time.Now().UTC(),
+		}
+	}
+
+	fo := MustCreate(dir, "test", 0, testSegmentSize)
+	for _, record := range records {
+		if err := fo.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// первые две записи подтверждены, следующие две выданы и не подтверждены до завершения работы
+	batch := fo.PopBatch(4)
+	if err := fo.Ack(batch[0].ID, batch[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := fo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := MustCreate(dir, "test", 0, testSegmentSize)
+	defer func() { _ = restored.Close() }()
+
+	if restored.Len() != len(records)-2 {
+		t.Fatalf("expected %d records, got %d", len(records)-2, restored.Len())
+	}
+
+	for i, want := range records[2:] {
+		got := restored.Pop()
+		if got.ID != want.ID || string(got.Message) != string(want.Message) || got.RoutingKey != want.RoutingKey ||
+			got.TraceParent != want.TraceParent || got.Attempt != want.Attempt || !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Fatalf("record %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	if !restored.IsEmpty() {
+		t.Fatal("outbox is not empty after popping all records")
+	}
+}
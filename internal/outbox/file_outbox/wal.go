@@ -0,0 +1,159 @@
+package file_outbox
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	opAdd byte = 1 // Запись добавлена в outbox
+	opAck byte = 2 // Запись удалена из outbox'а
+
+	segmentExt = ".wal"
+	headerSize = 8                // Длина тела записи журнала и его контрольная сумма
+	bodyPrefix = 1 + 8 + 16       // Операция, порядковый номер и идентификатор сообщения
+	maxBody    = 64 * 1024 * 1024 // Максимальная длина тела записи журнала
+)
+
+var (
+	ErrCorruptedRecord = errors.New("corrupted outbox journal record")
+	crcTable           = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// walRecord запись журнала outbox'а.
+type walRecord struct {
+	op      byte      // Операция
+	seq     uint64    // Порядковый номер добавления записи в outbox (для opAck не используется)
+	id      uuid.UUID // Идентификатор сообщения
+	message []byte    // Сообщение с метаданными (для opAck пустое)
+}
+
+// encode возвращает запись журнала в бинарном виде: длина тела, контрольная сумма CRC-32C тела и само тело.
+func (r walRecord) encode() []byte {
+	body := make([]byte, bodyPrefix+len(r.message))
+	body[0] = r.op
+	binary.BigEndian.PutUint64(body[1:9], r.seq)
+	copy(body[9:25], r.id[:])
+	copy(body[bodyPrefix:], r.message)
+
+	buf := make([]byte, headerSize, headerSize+len(body))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(body, crcTable))
+
+	return append(buf, body...)
+}
+
+// readRecord читает из r очередную запись журнала. Возвращает io.EOF, если записей больше нет, и
+// ErrCorruptedRecord, если запись обрезана или повреждена.
+func readRecord(r io.Reader) (walRecord, int64, error) {
+	header := make([]byte, headerSize)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) && n == 0 {
+			return walRecord{}, 0, io.EOF
+		}
+		return walRecord{}, 0, ErrCorruptedRecord
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < bodyPrefix || length > maxBody {
+		return walRecord{}, 0, ErrCorruptedRecord
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return walRecord{}, 0, ErrCorruptedRecord
+	}
+
+	if crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return walRecord{}, 0, ErrCorruptedRecord
+	}
+
+	record := walRecord{op: body[0], seq: binary.BigEndian.Uint64(body[1:9])}
+	copy(record.id[:], body[9:25])
+	if len(body) > bodyPrefix {
+		record.message = body[bodyPrefix:]
+	}
+
+	if record.op != opAdd && record.op != opAck {
+		return walRecord{}, 0, ErrCorruptedRecord
+	}
+
+	return record, int64(headerSize + length), nil
+}
+
+// readSegment вызывает apply для каждой записи сегмента path. Возвращает размер корректной части сегмента и
+// ErrCorruptedRecord, если после нее в сегменте есть обрезанная или поврежденная запись.
+func readSegment(path string, apply func(walRecord)) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var valid int64
+	reader := bufio.NewReader(file)
+	for {
+		record, size, errRead := readRecord(reader)
+		if errors.Is(errRead, io.EOF) {
+			return valid, nil
+		}
+		if errRead != nil {
+			return valid, errRead
+		}
+
+		apply(record)
+		valid += size
+	}
+}
+
+// segmentPath возвращает путь к файлу сегмента с номером num в каталоге dir.
+func segmentPath(dir string, num uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", num, segmentExt))
+}
+
+// listSegments возвращает номера сегментов в каталоге dir по возрастанию.
+func listSegments(dir string) ([]uint64, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var nums []uint64
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		num, errParse := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if errParse != nil {
+			continue
+		}
+		nums = append(nums, num)
+	}
+
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	return nums, nil
+}
+
+// syncDir сбрасывает на диск изменения каталога dir (создание и удаление файлов сегментов).
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+
+	return d.Sync()
+}
@@ -1,36 +1,47 @@
 /*
-Package id_outbox: наивная реализация интерфейса "github.com/lazylex/messaggio/internal/ports/record_outbox"
+Package id_outbox: наивная реализация интерфейса "github.com/lazylex/messaggio/internal/ports/record_outbox". Записи
+хранятся в памяти процесса и извлекаются в порядке добавления (FIFO). Записи, выданные методом PopBatch, хранятся
+отдельно до подтверждения (Ack) или возврата (Nack) - возвращенные записи помещаются в начало очереди в прежнем порядке.
+При завершении работы приложения записи теряются.
 */
 
 package record_outbox
 
 import (
+	"github.com/google/uuid"
 	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/ports/record_outbox"
 	"sync"
 )
 
 const initSize = 10
 
 type Naive struct {
-	mu   sync.Mutex
-	data []dto.MessageID
+	mu       sync.Mutex
+	data     []dto.MessageID // Очередь записей
+	leased   []dto.MessageID // Выданные методом PopBatch и еще не подтвержденные записи в порядке выдачи
+	capacity int             // Максимальное количество записей в outbox'е, 0 - без ограничения
 }
 
-// New возвращает структуру для работы с outbox'ом. Для идентификации в логах используется name.
-func New() *Naive {
-	return &Naive{data: make([]dto.MessageID, 0, initSize)}
+// New возвращает структуру для работы с outbox'ом, вмещающим не более capacity записей (при capacity равном 0 -
+// без ограничения).
+func New(capacity int) *Naive {
+	return &Naive{data: make([]dto.MessageID, 0, initSize), capacity: capacity}
 }
 
-// Add добавление записи в outbox.
+// Add добавление записи в outbox. Если outbox заполнен, возвращает ошибку record_outbox.ErrOutboxFull.
 func (n *Naive) Add(data dto.MessageID) error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
+	if n.isFull() {
+		return record_outbox.ErrOutboxFull
+	}
 	n.data = append(n.data, data)
 
 	return nil
 }
 
-// Pop извлечение записи из outbox'а.
+// Pop извлечение самой старой записи из outbox'а.
 func (n *Naive) Pop() dto.MessageID {
 	result := dto.MessageID{}
 	n.mu.Lock()
@@ -39,14 +50,122 @@ func (n *Naive) Pop() dto.MessageID {
 		return result
 	}
 
-	result, n.data = n.data[len(n.data)-1], n.data[:len(n.data)-1]
+	result = n.data[0]
+	n.data[0] = dto.MessageID{} // чтобы сообщение не удерживалось в памяти базовым массивом среза
+	n.data = n.data[1:]
 
 	return result
 }
 
-// IsEmpty возвращает true, если outbox пуст.
+// PopBatch выдает не более count самых старых записей. Выданные записи не возвращаются повторно до вызова Nack и
+// удаляются из outbox'а вызовом Ack.
+func (n *Naive) PopBatch(count int) []dto.MessageID {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	count = min(count, len(n.data))
+	if count <= 0 {
+		return nil
+	}
+
+	result := make([]dto.MessageID, count)
+	copy(result, n.data[:count])
+	clear(n.data[:count])
+	n.data = n.data[count:]
+	n.leased = append(n.leased, result...)
+
+	return result
+}
+
+// Peek возвращает самую старую запись без ее извлечения. Если outbox пуст, возвращает пустую структуру.
+func (n *Naive) Peek() dto.MessageID {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.data) == 0 {
+		return dto.MessageID{}
+	}
+
+	return n.data[0]
+}
+
+// Ack удаляет из outbox'а выданные методом PopBatch записи с идентификаторами ids.
+func (n *Naive) Ack(ids ...uuid.UUID) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.leased, _ = extract(n.leased, ids)
+
+	return nil
+}
+
+// Nack возвращает выданные методом PopBatch записи с идентификаторами ids в начало очереди в порядке их выдачи.
+func (n *Naive) Nack(ids ...uuid.UUID) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var returned []dto.MessageID
+	if n.leased, returned = extract(n.leased, ids); len(returned) > 0 {
+		n.data = append(returned, n.data...)
+	}
+
+	return nil
+}
+
+// extract возвращает записи из records, идентификаторы которых не входят в ids, и записи, идентификаторы которых входят.
+// Порядок записей сохраняется.
+func extract(records []dto.MessageID, ids []uuid.UUID) (rest, extracted []dto.MessageID) {
+	set := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	rest = records[:0]
+	for _, record := range records {
+		if _, ok := set[record.ID]; ok {
+			extracted = append(extracted, record)
+		} else {
+			rest = append(rest, record)
+		}
+	}
+	clear(records[len(rest):])
+
+	return rest, extracted
+}
+
+// IsEmpty возвращает true, если в outbox'е нет записей, в том числе выданных и не подтвержденных.
 func (n *Naive) IsEmpty() bool {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	return len(n.data) == 0
+	return len(n.data)+len(n.leased) == 0
+}
+
+// Contains возвращает true, если в outbox'е есть запись с идентификатором id.
+func (n *Naive) Contains(id uuid.UUID) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, records := range [][]dto.MessageID{n.data, n.leased} {
+		for _, record := range records {
+			if record.ID == id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Len возвращает количество записей в outbox'е, в том числе выданных и не подтвержденных.
+func (n *Naive) Len() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.data) + len(n.leased)
+}
+
+// IsFull возвращает true, если outbox заполнен.
+func (n *Naive) IsFull() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.isFull()
+}
+
+// isFull возвращает true, если outbox заполнен. Вызывается при захваченном мьютексе.
+func (n *Naive) isFull() bool {
+	return n.capacity > 0 && len(n.data)+len(n.leased) >= n.capacity
 }
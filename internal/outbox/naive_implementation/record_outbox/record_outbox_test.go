@@ -0,0 +1,13 @@
+package record_outbox
+
+import (
+	"github.com/lazylex/messaggio/internal/outbox/contract"
+	reo "github.com/lazylex/messaggio/internal/ports/record_outbox"
+	"testing"
+)
+
+func TestContract(t *testing.T) {
+	if err := contract.Verify(func() reo.Interface { return New(0) }); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,3 +1,12 @@
+/*
+Package redis_outbox: реализация интерфейса "github.com/lazylex/messaggio/internal/ports/record_outbox" на основе списка
+Redis. Записи хранятся в списке парами "идентификатор, сообщение с метаданными": добавляются в конец списка и
+извлекаются из его начала, поэтому извлекаются в порядке добавления (FIFO). Для каждого экземпляра приложения и
+outbox'а используется отдельный ключ, поэтому порядок сохраняется в пределах одного экземпляра. Записи, выданные
+методом PopBatch, атомарно переносятся в отдельный список и хранятся в нем до подтверждения (Ack) или возврата в
+начало очереди (Nack). Outbox переживает перезапуск приложения: при создании outbox'а не подтвержденные записи
+возвращаются в начало очереди.
+*/
 package redis_outbox
 
 import (
@@ -5,24 +14,95 @@ import (
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
 	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/ports/record_outbox"
 	"github.com/redis/go-redis/v9"
 	"log/slog"
 	"os"
 )
 
-const outboxPrefix = "rop"
+const (
+	outboxPrefix = "rop"
+	leasedSuffix = "leased"
+)
+
+var (
+	// addScript атомарно добавляет запись в конец очереди KEYS[1], если количество записей в очереди и в списке
+	// выданных записей KEYS[2] меньше ARGV[3] (при ARGV[3] равном 0 - без ограничения). Каждая запись занимает в списке
+	// два элемента. Возвращает 0, если outbox заполнен.
+	addScript = redis.NewScript(`
+local capacity = tonumber(ARGV[3])
+if capacity > 0 and redis.call('LLEN', KEYS[1]) + redis.call('LLEN', KEYS[2]) >= capacity * 2 then
+	return 0
+end
+redis.call('RPUSH', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+	// popBatchScript атомарно переносит не более ARGV[1] записей из начала очереди KEYS[1] в конец списка выданных
+	// записей KEYS[2] и возвращает их.
+	popBatchScript = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[1], 0, tonumber(ARGV[1]) * 2 - 1)
+if #items > 0 then
+	redis.call('LTRIM', KEYS[1], #items, -1)
+	redis.call('RPUSH', KEYS[2], unpack(items))
+end
+return items
+`)
+
+	// releaseScript атомарно удаляет из списка выданных записей KEYS[2] записи с идентификаторами ARGV[2..]. При
+	// ARGV[1] равном 1 удаленные записи возвращаются в начало очереди KEYS[1] в прежнем порядке. Записи, добавленные
+	// предыдущими версиями приложения в формате "сообщение, идентификатор", также распознаются.
+	releaseScript = redis.NewScript(`
+local ids = {}
+for i = 2, #ARGV do
+	ids[ARGV[i]] = true
+end
+local items = redis.call('LRANGE', KEYS[2], 0, -1)
+local rest, selected = {}, {}
+for i = 1, #items - 1, 2 do
+	local target = rest
+	if ids[items[i]] or ids[items[i + 1]] then
+		target = selected
+	end
+	table.insert(target, items[i])
+	table.insert(target, items[i + 1])
+end
+redis.call('DEL', KEYS[2])
+if #rest > 0 then
+	redis.call('RPUSH', KEYS[2], unpack(rest))
+end
+if ARGV[1] == '1' then
+	for i = #selected, 1, -1 do
+		redis.call('LPUSH', KEYS[1], selected[i])
+	end
+end
+return #selected / 2
+`)
+
+	// requeueScript атомарно возвращает все записи из списка выданных записей KEYS[2] в начало очереди KEYS[1] в
+	// прежнем порядке. Возвращает количество возвращенных записей.
+	requeueScript = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[2], 0, -1)
+for i = #items, 1, -1 do
+	redis.call('LPUSH', KEYS[1], items[i])
+end
+redis.call('DEL', KEYS[2])
+return #items / 2
+`)
+)
 
 type RedisOutbox struct {
 	client   *redis.Client // Клиент redis-сервера
 	instance string        // Уникальный идентификатор экземпляра приложения для генерации ключей
 	name     string        // Уникальное имя экземпляра outbox'а
+	capacity int           // Максимальное количество записей в outbox'е, 0 - без ограничения
 }
 
-// MustCreate создание структуры с клиентом для взаимодействия с Redis. При ошибке соединения с сервером Redis выводит
-// ошибку в лог и прекращает работу приложения.
-func MustCreate(client *redis.Client, name, instance string) *RedisOutbox {
+// MustCreate создание структуры с клиентом для взаимодействия с Redis. Outbox вмещает не более capacity записей (при
+// capacity равном 0 - без ограничения). Записи, выданные до перезапуска приложения и не подтвержденные, возвращаются
+// в начало очереди. При ошибке соединения с сервером Redis выводит ошибку в лог и прекращает работу приложения.
+func MustCreate(client *redis.Client, name, instance string, capacity int) *RedisOutbox {
 
 	if _, err := client.Ping(context.Background()).Result(); err != nil {
 		slog.Error(err.Error())
@@ -31,43 +111,178 @@ func MustCreate(client *redis.Client, name, instance string) *RedisOutbox {
 		slog.Info("successfully received pong from redis server")
 	}
 
-	return &RedisOutbox{client: client, instance: instance, name: name}
+	ro := &RedisOutbox{client: client, instance: instance, name: name, capacity: capacity}
+
+	requeued, err := requeueScript.Run(context.Background(), client, ro.keys()).Int()
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if requeued > 0 {
+		slog.Warn(fmt.Sprintf("%d unacknowledged records returned to outbox %s", requeued, name))
+	}
+
+	return ro
 }
 
-// Add добавляет сообщение и идентификатор в список.
+// Add добавляет идентификатор и сообщение с метаданными в конец списка. Если outbox заполнен, возвращает
+// ошибку record_outbox.ErrOutboxFull.
 func (ro *RedisOutbox) Add(data dto.MessageID) error {
 	if len(string(data.Message)) == 0 || data.ID == uuid.Nil {
 		return errors.New("data is empty")
 	}
 
 	ctx := context.Background()
-	return ro.client.LPush(ctx, ro.key(), data.ID.String(), string(data.Message)).Err()
+	added, err := addScript.Run(ctx, ro.client, ro.keys(), data.ID.String(), record_outbox.Marshal(data),
+		ro.capacity).Int()
+	if err != nil {
+		return err
+	}
+
+	if added == 0 {
+		return record_outbox.ErrOutboxFull
+	}
+
+	return nil
 }
 
-// Pop извлекает сообщение и идентификатор из списка. Если список пуст, возвращает пустую структуру.
+// Pop извлекает самую старую запись (идентификатор и сообщение) из начала списка. Если список пуст, возвращает пустую
+// структуру.
 func (ro *RedisOutbox) Pop() dto.MessageID {
-	var id uuid.UUID
 	ctx := context.Background()
 
 	data, err := ro.client.LPopCount(ctx, ro.key(), 2).Result()
 
-	if err != nil {
+	if err != nil || len(data) < 2 {
 		return dto.MessageID{}
 	}
 
-	if id, err = uuid.Parse(data[1]); err != nil {
+	return parseRecord(data[0], data[1])
+}
+
+// PopBatch выдает не более count самых старых записей. Выданные записи не возвращаются повторно до вызова Nack и
+// удаляются из outbox'а вызовом Ack.
+func (ro *RedisOutbox) PopBatch(count int) []dto.MessageID {
+	if count <= 0 {
+		return nil
+	}
+
+	data, err := popBatchScript.Run(context.Background(), ro.client, ro.keys(), count).StringSlice()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			slog.Error(err.Error())
+		}
+		return nil
+	}
+
+	result := make([]dto.MessageID, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if record := parseRecord(data[i], data[i+1]); record.ID != uuid.Nil {
+			result = append(result, record)
+		}
+	}
+
+	return result
+}
+
+// Peek возвращает самую старую запись без ее извлечения. Если outbox пуст, возвращает пустую структуру.
+func (ro *RedisOutbox) Peek() dto.MessageID {
+	data, err := ro.client.LRange(context.Background(), ro.key(), 0, 1).Result()
+	if err != nil || len(data) < 2 {
 		return dto.MessageID{}
 	}
 
-	return dto.MessageID{ID: id, Message: message.Message(data[0])}
+	return parseRecord(data[0], data[1])
+}
+
+// Ack удаляет из outbox'а выданные методом PopBatch записи с идентификаторами ids.
+func (ro *RedisOutbox) Ack(ids ...uuid.UUID) error {
+	return ro.release(false, ids)
+}
+
+// Nack возвращает выданные методом PopBatch записи с идентификаторами ids в начало очереди в порядке их выдачи.
+func (ro *RedisOutbox) Nack(ids ...uuid.UUID) error {
+	return ro.release(true, ids)
+}
+
+// release удаляет из списка выданных записей записи с идентификаторами ids, при requeue равном true возвращая их в
+// начало очереди.
+func (ro *RedisOutbox) release(requeue bool, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, 0)
+	if requeue {
+		args[0] = 1
+	}
+	for _, id := range ids {
+		args = append(args, id.String())
+	}
+
+	return releaseScript.Run(context.Background(), ro.client, ro.keys(), args...).Err()
+}
+
+// parseRecord возвращает запись из пары элементов списка. Записи, добавленные предыдущими версиями приложения в
+// формате "сообщение, идентификатор" или без метаданных, также распознаются. Если идентификатор не распознан,
+// возвращает пустую структуру.
+func parseRecord(first, second string) dto.MessageID {
+	if id, err := uuid.Parse(first); err == nil {
+		return record_outbox.Unmarshal(id, []byte(second))
+	}
+
+	if id, err := uuid.Parse(second); err == nil {
+		return record_outbox.Unmarshal(id, []byte(first))
+	}
+
+	return dto.MessageID{}
 }
 
-// IsEmpty возвращает true, если outbox пуст.
+// IsEmpty возвращает true, если в outbox'е нет записей, в том числе выданных и не подтвержденных.
 func (ro *RedisOutbox) IsEmpty() bool {
-	return ro.client.LLen(context.Background(), ro.key()).Val() == 0
+	return ro.Len() == 0
+}
+
+// Contains возвращает true, если в outbox'е есть запись с идентификатором id.
+func (ro *RedisOutbox) Contains(id uuid.UUID) bool {
+	for _, key := range ro.keys() {
+		if _, err := ro.client.LPos(context.Background(), key, id.String(), redis.LPosArgs{}).Result(); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Len возвращает количество записей в outbox'е, в том числе выданных и не подтвержденных. Каждая запись занимает в
+// списке два элемента.
+func (ro *RedisOutbox) Len() int {
+	ctx := context.Background()
+	return int((ro.client.LLen(ctx, ro.key()).Val() + ro.client.LLen(ctx, ro.leasedKey()).Val()) / 2)
+}
+
+// IsFull возвращает true, если outbox заполнен.
+func (ro *RedisOutbox) IsFull() bool {
+	return ro.capacity > 0 && ro.Len() >= ro.capacity
+}
+
+// Ping проверяет соединение с сервером Redis.
+func (ro *RedisOutbox) Ping(ctx context.Context) error {
+	return ro.client.Ping(ctx).Err()
 }
 
 // key возвращает ключ, по которому в Redis будут сохраняться данные в списке.
 func (ro *RedisOutbox) key() string {
 	return fmt.Sprintf("%s:%s:%s", outboxPrefix, ro.name, ro.instance)
 }
+
+// leasedKey возвращает ключ списка выданных методом PopBatch и не подтвержденных записей.
+func (ro *RedisOutbox) leasedKey() string {
+	return fmt.Sprintf("%s:%s", ro.key(), leasedSuffix)
+}
+
+// keys возвращает ключи очереди и списка выданных записей для передачи в скрипты.
+func (ro *RedisOutbox) keys() []string {
+	return []string{ro.key(), ro.leasedKey()}
+}
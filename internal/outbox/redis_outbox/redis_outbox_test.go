@@ -0,0 +1,48 @@
+package redis_outbox
+
+import (
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/outbox/contract"
+	"github.com/lazylex/messaggio/internal/outbox/redistest"
+	"github.com/lazylex/messaggio/internal/ports/record_outbox"
+	"testing"
+)
+
+func TestContract(t *testing.T) {
+	client := redistest.NewClient(t)
+	create := func() record_outbox.Interface { return MustCreate(client, uuid.NewString(), "test", 0) }
+
+	if err := contract.Verify(create); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequeueOnCreate(t *testing.T) {
+	client := redistest.NewClient(t)
+	ro := MustCreate(client, "test", "test", 0)
+
+	records := []dto.MessageID{
+		{ID: uuid.New(), Message: message.Message("first"), RoutingKey: "route"},
+		{ID: uuid.New(), Message: message.Message("second"), RoutingKey: "route"},
+	}
+	for _, record := range records {
+		if err := ro.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if batch := ro.PopBatch(len(records)); len(batch) != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), len(batch))
+	}
+
+	// выданные и не подтвержденные записи возвращаются в начало очереди при создании outbox'а после перезапуска
+	restored := MustCreate(client, "test", "test", 0)
+	for i, want := range records {
+		got := restored.Pop()
+		if got.ID != want.ID || string(got.Message) != string(want.Message) || got.RoutingKey != want.RoutingKey {
+			t.Fatalf("record %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
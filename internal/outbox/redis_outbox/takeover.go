@@ -0,0 +1,196 @@
+package redis_outbox
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	instancesKey    = "instances"
+	heartbeatPrefix = "heartbeat"
+	takeoverPrefix  = "takeover"
+)
+
+var (
+	// adoptScript атомарно переносит записи очереди KEYS[1] и списка выданных записей KEYS[2] другого экземпляра
+	// приложения в конец очереди KEYS[3] (выданные записи - первыми, как более старые). Переносится не больше записей,
+	// чем осталось места в outbox'е с очередью KEYS[3] и списком выданных записей KEYS[4] вместимостью ARGV[1] (при
+	// ARGV[1] равном 0 - без ограничения), остальные записи остаются в исходных списках. Возвращает количество
+	// перенесенных и оставшихся записей.
+	adoptScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local free = capacity - (redis.call('LLEN', KEYS[3]) + redis.call('LLEN', KEYS[4])) / 2
+local moved = 0
+for _, key in ipairs({KEYS[2], KEYS[1]}) do
+	while capacity == 0 or moved < free do
+		local first = redis.call('LPOP', key)
+		if not first then
+			break
+		end
+		local second = redis.call('LPOP', key)
+		if second then
+			redis.call('RPUSH', KEYS[3], first, second)
+		else
+			redis.call('RPUSH', KEYS[3], first)
+		end
+		moved = moved + 1
+	end
+end
+return {moved, (redis.call('LLEN', KEYS[1]) + redis.call('LLEN', KEYS[2])) / 2}
+`)
+
+	// unlockScript удаляет блокировку KEYS[1], если она принадлежит экземпляру ARGV[1].
+	unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+// Adopt переносит записи outbox'а с тем же именем, принадлежащего экземпляру приложения orphan, в конец очереди этого
+// outbox'а, но не больше, чем в нем осталось места. Возвращает количество перенесенных и оставшихся у orphan записей.
+func (ro *RedisOutbox) Adopt(ctx context.Context, orphan string) (adopted, remaining int, err error) {
+	source := &RedisOutbox{client: ro.client, instance: orphan, name: ro.name}
+	keys := append(source.keys(), ro.keys()...)
+
+	result, err := adoptScript.Run(ctx, ro.client, keys, ro.capacity).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(result[0]), int(result[1]), nil
+}
+
+// Takeover структура, поддерживающая признак жизни (heartbeat) экземпляра приложения в Redis и забирающая записи
+// outbox'ов экземпляров, признак жизни которых истек.
+type Takeover struct {
+	client   *redis.Client  // Клиент redis-сервера
+	instance string         // Уникальный идентификатор экземпляра приложения
+	ttl      time.Duration  // Время жизни признака жизни и блокировки при переносе записей
+	outboxes []*RedisOutbox // Outbox'ы этого экземпляра, в которые переносятся записи
+}
+
+// MustStartTakeover регистрирует экземпляр приложения instance в Redis и запускает go-рутину, которая каждую треть ttl
+// обновляет его признак жизни со временем жизни ttl и переносит в outboxes записи одноименных outbox'ов
+// зарегистрированных экземпляров, признак жизни которых истек. Перенос записей каждого экземпляра защищен блокировкой,
+// поэтому выполняется только одним из живых экземпляров. Go-рутина завершается при отмене ctx. При ошибке
+// взаимодействия с сервером Redis выводит ошибку в лог и прекращает работу приложения.
+func MustStartTakeover(ctx context.Context, client *redis.Client, instance string, ttl time.Duration,
+	outboxes ...*RedisOutbox) *Takeover {
+	t := &Takeover{client: client, instance: instance, ttl: ttl, outboxes: outboxes}
+
+	if ttl <= 0 {
+		slog.Error("redis heartbeat ttl must be positive")
+		os.Exit(1)
+	}
+
+	if err := t.heartbeat(ctx); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := t.heartbeat(ctx); err != nil {
+					slog.Error(err.Error())
+					continue
+				}
+				t.adoptOrphans(ctx)
+			}
+		}
+	}()
+
+	return t
+}
+
+// heartbeat обновляет признак жизни экземпляра и добавляет экземпляр в множество зарегистрированных.
+func (t *Takeover) heartbeat(ctx context.Context) error {
+	_, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, heartbeatKey(t.instance), time.Now().UTC().Format(time.RFC3339), t.ttl)
+		pipe.SAdd(ctx, fmt.Sprintf("%s:%s", outboxPrefix, instancesKey), t.instance)
+		return nil
+	})
+
+	return err
+}
+
+// adoptOrphans переносит записи outbox'ов зарегистрированных экземпляров, признак жизни которых истек, и удаляет эти
+// экземпляры из множества зарегистрированных.
+func (t *Takeover) adoptOrphans(ctx context.Context) {
+	instances, err := t.client.SMembers(ctx, fmt.Sprintf("%s:%s", outboxPrefix, instancesKey)).Result()
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	for _, orphan := range instances {
+		if orphan == t.instance {
+			continue
+		}
+
+		if alive, errExists := t.client.Exists(ctx, heartbeatKey(orphan)).Result(); errExists != nil || alive > 0 {
+			continue
+		}
+
+		if err = t.adopt(ctx, orphan); err != nil {
+			slog.Error(err.Error(), slog.String("orphan", orphan))
+		}
+	}
+}
+
+// adopt под блокировкой переносит записи outbox'ов экземпляра orphan и удаляет его из множества зарегистрированных.
+// Если блокировка удерживается другим экземпляром, ничего не делает. Если записи не поместились в outbox'ы этого
+// экземпляра, orphan остается в множестве зарегистрированных и оставшиеся записи переносятся при следующих проверках.
+func (t *Takeover) adopt(ctx context.Context, orphan string) error {
+	lock := fmt.Sprintf("%s:%s:%s", outboxPrefix, takeoverPrefix, orphan)
+	locked, err := t.client.SetNX(ctx, lock, t.instance, t.ttl).Result()
+	if err != nil || !locked {
+		return err
+	}
+	defer func() {
+		if errUnlock := unlockScript.Run(ctx, t.client, []string{lock}, t.instance).Err(); errUnlock != nil {
+			slog.Error(errUnlock.Error())
+		}
+	}()
+
+	left := 0
+	for _, outbox := range t.outboxes {
+		adopted, remaining, errAdopt := outbox.Adopt(ctx, orphan)
+		if errAdopt != nil {
+			return errAdopt
+		}
+
+		if adopted > 0 {
+			slog.Warn(fmt.Sprintf("%d records of outbox %s adopted from instance %s", adopted, outbox.name, orphan))
+		}
+
+		if remaining > 0 {
+			slog.Warn(fmt.Sprintf("%d records of outbox %s left at instance %s: outbox is full", remaining,
+				outbox.name, orphan))
+		}
+		left += remaining
+	}
+
+	if left > 0 {
+		return nil
+	}
+
+	return t.client.SRem(ctx, fmt.Sprintf("%s:%s", outboxPrefix, instancesKey), orphan).Err()
+}
+
+// heartbeatKey возвращает ключ признака жизни экземпляра приложения instance.
+func heartbeatKey(instance string) string {
+	return fmt.Sprintf("%s:%s:%s", outboxPrefix, heartbeatPrefix, instance)
+}
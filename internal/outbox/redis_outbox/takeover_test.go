@@ -0,0 +1,173 @@
+package redis_outbox
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/outbox/redistest"
+	"testing"
+	"time"
+)
+
+// addRecords добавляет в outbox count записей и возвращает их в порядке добавления.
+func addRecords(t *testing.T, ro *RedisOutbox, count int) []dto.MessageID {
+	records := make([]dto.MessageID, count)
+	for i := range records {
+		records[i] = dto.MessageID{ID: uuid.New(), Message: message.Message(fmt.Sprintf("%s %d", ro.instance, i))}
+		if err := ro.Add(records[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return records
+}
+
+// popInOrder проверяет, что из outbox'а извлекаются записи expected в том же порядке.
+func popInOrder(t *testing.T, ro *RedisOutbox, expected []dto.MessageID) {
+	for i, want := range expected {
+		if got := ro.Pop(); got.ID != want.ID {
+			t.Fatalf("record %d: expected %s, got %s", i, want.ID, got.ID)
+		}
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	client := redistest.NewClient(t)
+	orphan := MustCreate(client, "test", "orphan", 0)
+	records := addRecords(t, orphan, 4)
+
+	// выданные и не подтвержденные записи переносятся первыми
+	if batch := orphan.PopBatch(2); len(batch) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(batch))
+	}
+
+	ro := MustCreate(client, "test", "test", 3)
+	own := addRecords(t, ro, 1)
+
+	adopted, remaining, err := ro.Adopt(context.Background(), "orphan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adopted != 2 || remaining != 2 || !ro.IsFull() {
+		t.Fatalf("expected 2 adopted and 2 remaining records, got %d and %d", adopted, remaining)
+	}
+
+	popInOrder(t, ro, append(own, records[:2]...))
+
+	adopted, remaining, err = ro.Adopt(context.Background(), "orphan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adopted != 2 || remaining != 0 {
+		t.Fatalf("expected 2 adopted and 0 remaining records, got %d and %d", adopted, remaining)
+	}
+
+	popInOrder(t, ro, records[2:])
+	if !ro.IsEmpty() || !orphan.IsEmpty() {
+		t.Fatalf("expected empty outboxes, got %d and %d records", ro.Len(), orphan.Len())
+	}
+}
+
+func TestTakeover(t *testing.T) {
+	const ttl = time.Minute
+
+	ctx := context.Background()
+	server, client := redistest.Run(t)
+
+	orphanOutbox := MustCreate(client, "test", "orphan", 0)
+	records := addRecords(t, orphanOutbox, 3)
+	orphan := &Takeover{client: client, instance: "orphan", ttl: ttl, outboxes: []*RedisOutbox{orphanOutbox}}
+
+	ro := MustCreate(client, "test", "test", 0)
+	takeover := &Takeover{client: client, instance: "test", ttl: ttl, outboxes: []*RedisOutbox{ro}}
+
+	for _, instance := range []*Takeover{orphan, takeover} {
+		if err := instance.heartbeat(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// записи экземпляра, признак жизни которого не истек, не переносятся
+	takeover.adoptOrphans(ctx)
+	if !ro.IsEmpty() {
+		t.Fatalf("expected no records adopted from alive instance, got %d", ro.Len())
+	}
+
+	server.FastForward(ttl + time.Second)
+	if err := takeover.heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// перенос записей, блокировка которого удерживается другим экземпляром, не выполняется
+	lock := fmt.Sprintf("%s:%s:%s", outboxPrefix, takeoverPrefix, "orphan")
+	if err := client.SetNX(ctx, lock, "other", ttl).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	takeover.adoptOrphans(ctx)
+	if !ro.IsEmpty() || orphanOutbox.Len() != len(records) {
+		t.Fatalf("expected no records adopted under foreign lock, got %d", ro.Len())
+	}
+
+	server.FastForward(ttl + time.Second)
+	if err := takeover.heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	takeover.adoptOrphans(ctx)
+	popInOrder(t, ro, records)
+
+	if !orphanOutbox.IsEmpty() {
+		t.Fatalf("expected empty orphan outbox, got %d records", orphanOutbox.Len())
+	}
+
+	registered, err := client.SIsMember(ctx, fmt.Sprintf("%s:%s", outboxPrefix, instancesKey), "orphan").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered {
+		t.Fatal("expected orphan instance to be unregistered after takeover")
+	}
+
+	if exists := client.Exists(ctx, lock).Val(); exists != 0 {
+		t.Fatal("expected takeover lock to be released")
+	}
+}
+
+func TestTakeoverFullOutbox(t *testing.T) {
+	const ttl = time.Minute
+
+	ctx := context.Background()
+	server, client := redistest.Run(t)
+	instances := fmt.Sprintf("%s:%s", outboxPrefix, instancesKey)
+
+	orphanOutbox := MustCreate(client, "test", "orphan", 0)
+	records := addRecords(t, orphanOutbox, 2)
+	orphan := &Takeover{client: client, instance: "orphan", ttl: ttl, outboxes: []*RedisOutbox{orphanOutbox}}
+	if err := orphan.heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	server.FastForward(ttl + time.Second)
+
+	ro := MustCreate(client, "test", "test", 1)
+	takeover := &Takeover{client: client, instance: "test", ttl: ttl, outboxes: []*RedisOutbox{ro}}
+	if err := takeover.heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// не поместившиеся записи остаются у экземпляра, который остается зарегистрированным до их переноса
+	for i, want := range records {
+		takeover.adoptOrphans(ctx)
+		if got := ro.Pop(); got.ID != want.ID {
+			t.Fatalf("record %d: expected %s, got %s", i, want.ID, got.ID)
+		}
+
+		registered := client.SIsMember(ctx, instances, "orphan").Val()
+		if last := i == len(records)-1; registered == last {
+			t.Fatalf("record %d: expected orphan registered %t, got %t", i, !last, registered)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+/*
+Package redis_stream_outbox: реализация интерфейса "github.com/lazylex/messaggio/internal/ports/record_outbox" на
+основе Redis Streams. Каждая запись хранится одним элементом потока с полями id и message (сообщение вместе с
+метаданными), поэтому не может быть сохранена частично. Поток и группа потребителей общие для всех экземпляров
+приложения, каждый экземпляр является отдельным потребителем группы (имя потребителя - идентификатор экземпляра).
+
+Выданные методом PopBatch записи остаются в списке ожидающих подтверждения (PEL) потребителя до вызова Ack, который
+удаляет их из потока. Записи, возвращенные методом Nack, выдаются этому же потребителю повторно раньше новых. Записи,
+выданные экземпляру, который завершил работу аварийно, и не подтвержденные в течение claimIdle, забираются другим
+экземпляром командой XAUTOCLAIM. Записи выдаются в порядке добавления в пределах каждой из групп: возвращенные,
+забранные у других экземпляров, новые.
+
+Количество записей и заполненность outbox'а считаются отдельно для каждого экземпляра: запись принадлежит экземпляру,
+который ее добавил, а после выдачи - экземпляру, которому она выдана. Поэтому накопившиеся записи одного экземпляра не
+приводят к заполнению outbox'а и отказу в приеме сообщений на других экземплярах.
+*/
+package redis_stream_outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/ports/record_outbox"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	outboxPrefix = "ros"
+	idsSuffix    = "ids"
+	ownersSuffix = "owners"
+	depthSuffix  = "depth"
+	fieldID      = "id"
+	fieldMessage = "message"
+)
+
+var (
+	// addScript атомарно добавляет запись в поток KEYS[1] и ее идентификатор в хэш KEYS[2], если количество записей
+	// потребителя ARGV[4] в хэше KEYS[4] меньше ARGV[3] (при ARGV[3] равном 0 - без ограничения). Потребитель
+	// становится владельцем записи в хэше KEYS[3]. Возвращает 0, если outbox потребителя заполнен. Запись с
+	// идентификатором, уже имеющимся в хэше, не добавляется, иначе Ack удалил бы только последний элемент потока с этим
+	// идентификатором, а предыдущие выдавались бы из списка ожидающих подтверждения повторно.
+	addScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 1 then
+	return 1
+end
+local capacity = tonumber(ARGV[3])
+if capacity > 0 and tonumber(redis.call('HGET', KEYS[4], ARGV[4]) or 0) >= capacity then
+	return 0
+end
+local entry = redis.call('XADD', KEYS[1], '*', 'id', ARGV[1], 'message', ARGV[2])
+redis.call('HSET', KEYS[2], ARGV[1], entry)
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[4])
+redis.call('HINCRBY', KEYS[4], ARGV[4], 1)
+return 1
+`)
+
+	// ackScript атомарно подтверждает обработку группой ARGV[1] и удаляет из потока KEYS[1] записи с идентификаторами
+	// ARGV[2..], удаляет идентификаторы из хэшей KEYS[2] и KEYS[3] и уменьшает количество записей их владельцев в
+	// хэше KEYS[4].
+	ackScript = redis.NewScript(`
+for i = 2, #ARGV do
+	local entry = redis.call('HGET', KEYS[2], ARGV[i])
+	if entry then
+		redis.call('XACK', KEYS[1], ARGV[1], entry)
+		redis.call('XDEL', KEYS[1], entry)
+		redis.call('HDEL', KEYS[2], ARGV[i])
+		local owner = redis.call('HGET', KEYS[3], ARGV[i])
+		if owner then
+			redis.call('HDEL', KEYS[3], ARGV[i])
+			if redis.call('HINCRBY', KEYS[4], owner, -1) <= 0 then
+				redis.call('HDEL', KEYS[4], owner)
+			end
+		end
+	end
+end
+return 1
+`)
+
+	// ownScript атомарно передает потребителю ARGV[1] владение записями с идентификаторами ARGV[2..], еще находящимися
+	// в outbox'е, и переносит их в количестве записей потребителя в хэше KEYS[4] от прежних владельцев.
+	ownScript = redis.NewScript(`
+for i = 2, #ARGV do
+	if redis.call('HEXISTS', KEYS[2], ARGV[i]) == 1 then
+		local owner = redis.call('HGET', KEYS[3], ARGV[i])
+		if owner ~= ARGV[1] then
+			if owner and redis.call('HINCRBY', KEYS[4], owner, -1) <= 0 then
+				redis.call('HDEL', KEYS[4], owner)
+			end
+			redis.call('HSET', KEYS[3], ARGV[i], ARGV[1])
+			redis.call('HINCRBY', KEYS[4], ARGV[1], 1)
+		end
+	end
+end
+return 1
+`)
+)
+
+type RedisStreamOutbox struct {
+	mu        sync.Mutex
+	client    *redis.Client          // Клиент redis-сервера
+	name      string                 // Уникальное имя outbox'а, используемое в ключе потока и в качестве имени группы
+	consumer  string                 // Имя потребителя группы - идентификатор экземпляра приложения
+	capacity  int                    // Максимальное количество записей экземпляра в outbox'е, 0 - без ограничения
+	claimIdle time.Duration          // Время без подтверждения, после которого запись другого экземпляра забирается
+	leased    map[uuid.UUID]struct{} // Выданные методом PopBatch и еще не подтвержденные или не возвращенные записи
+}
+
+// MustCreate создание структуры с клиентом для взаимодействия с Redis. Создает поток и группу потребителей, если они
+// не существуют. Outbox вмещает не более capacity записей этого экземпляра (при capacity равном 0 - без ограничения),
+// записи, не подтвержденные другим экземпляром приложения в течение claimIdle, забираются этим экземпляром. При ошибке
+// взаимодействия с сервером Redis выводит ошибку в лог и прекращает работу приложения.
+func MustCreate(client *redis.Client, name, instance string, capacity int, claimIdle time.Duration) *RedisStreamOutbox {
+	ctx := context.Background()
+
+	if _, err := client.Ping(ctx).Result(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	} else {
+		slog.Info("successfully received pong from redis server")
+	}
+
+	rso := &RedisStreamOutbox{
+		client:    client,
+		name:      name,
+		consumer:  instance,
+		capacity:  capacity,
+		claimIdle: claimIdle,
+		leased:    make(map[uuid.UUID]struct{}),
+	}
+
+	err := client.XGroupCreateMkStream(ctx, rso.key(), rso.name, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	return rso
+}
+
+// Add добавляет запись в конец потока. Если запись с тем же идентификатором уже есть в outbox'е, повторно она не
+// добавляется. Экземпляр становится владельцем записи. Если outbox экземпляра заполнен, возвращает ошибку
+// record_outbox.ErrOutboxFull.
+func (rso *RedisStreamOutbox) Add(data dto.MessageID) error {
+	if len(string(data.Message)) == 0 || data.ID == uuid.Nil {
+		return errors.New("data is empty")
+	}
+
+	added, err := addScript.Run(context.Background(), rso.client, rso.keys(), data.ID.String(),
+		record_outbox.Marshal(data), rso.capacity, rso.consumer).Int()
+	if err != nil {
+		return err
+	}
+
+	if added == 0 {
+		return record_outbox.ErrOutboxFull
+	}
+
+	return nil
+}
+
+// Pop извлекает самую старую доступную запись и сразу удаляет ее из потока. Если outbox пуст, возвращает пустую
+// структуру.
+func (rso *RedisStreamOutbox) Pop() dto.MessageID {
+	batch := rso.PopBatch(1)
+	if len(batch) == 0 {
+		return dto.MessageID{}
+	}
+
+	if err := rso.Ack(batch[0].ID); err != nil {
+		slog.Error(err.Error())
+	}
+
+	return batch[0]
+}
+
+// PopBatch выдает не более count записей: сначала возвращенные методом Nack, затем забранные у экземпляров, не
+// подтвердивших их в течение claimIdle, затем новые. Выданные записи не возвращаются повторно до вызова Nack и
+// удаляются из outbox'а вызовом Ack. Экземпляр становится владельцем выданных записей.
+func (rso *RedisStreamOutbox) PopBatch(count int) []dto.MessageID {
+	rso.mu.Lock()
+	defer rso.mu.Unlock()
+
+	if count <= 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	result := make([]dto.MessageID, 0, count)
+
+	for _, next := range []func(context.Context, int) ([]redis.XMessage, error){rso.pending, rso.claim, rso.fresh} {
+		if len(result) == count {
+			break
+		}
+
+		entries, err := next(ctx, count-len(result))
+		if err != nil {
+			slog.Error(err.Error())
+			continue
+		}
+
+		for _, entry := range entries {
+			record, ok := parseEntry(entry)
+			if !ok {
+				// запись удалена из потока, но осталась в списке ожидающих подтверждения
+				rso.client.XAck(ctx, rso.key(), rso.name, entry.ID)
+				continue
+			}
+
+			if _, leased := rso.leased[record.ID]; leased || len(result) == count {
+				continue
+			}
+
+			rso.leased[record.ID] = struct{}{}
+			result = append(result, record)
+		}
+	}
+
+	if err := rso.own(ctx, result); err != nil {
+		slog.Error(err.Error())
+	}
+
+	return result
+}
+
+// own передает этому экземпляру владение записями batch, добавленными или ранее выданными другими экземплярами.
+func (rso *RedisStreamOutbox) own(ctx context.Context, batch []dto.MessageID) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(batch)+1)
+	args = append(args, rso.consumer)
+	for _, record := range batch {
+		args = append(args, record.ID.String())
+	}
+
+	return ownScript.Run(ctx, rso.client, rso.keys(), args...).Err()
+}
+
+// pending возвращает записи из списка ожидающих подтверждения этого потребителя, в том числе выданные и еще не
+// подтвержденные (они отбрасываются в PopBatch).
+func (rso *RedisStreamOutbox) pending(ctx context.Context, count int) ([]redis.XMessage, error) {
+	return rso.read(ctx, "0", count+len(rso.leased))
+}
+
+// fresh возвращает записи, еще не выданные ни одному потребителю.
+func (rso *RedisStreamOutbox) fresh(ctx context.Context, count int) ([]redis.XMessage, error) {
+	return rso.read(ctx, ">", count)
+}
+
+// read читает не более count записей потока для этого потребителя начиная с id без ожидания новых записей.
+func (rso *RedisStreamOutbox) read(ctx context.Context, id string, count int) ([]redis.XMessage, error) {
+	streams, err := rso.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    rso.name,
+		Consumer: rso.consumer,
+		Streams:  []string{rso.key(), id},
+		Count:    int64(count),
+		Block:    -1,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil || len(streams) == 0 {
+		return nil, err
+	}
+
+	return streams[0].Messages, nil
+}
+
+// claim забирает не более count записей, не подтвержденных другими потребителями в течение claimIdle.
+func (rso *RedisStreamOutbox) claim(ctx context.Context, count int) ([]redis.XMessage, error) {
+	if rso.claimIdle <= 0 {
+		return nil, nil
+	}
+
+	entries, _, err := rso.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   rso.key(),
+		Group:    rso.name,
+		Consumer: rso.consumer,
+		MinIdle:  rso.claimIdle,
+		Start:    "0-0",
+		Count:    int64(count),
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+
+	if len(entries) > 0 {
+		slog.Warn(fmt.Sprintf("%d records claimed from outbox %s", len(entries), rso.name))
+	}
+
+	return entries, err
+}
+
+// parseEntry возвращает запись из элемента потока. Записи, добавленные предыдущими версиями приложения без
+// метаданных, также распознаются. Если элемент не содержит корректной записи, возвращает false.
+func parseEntry(entry redis.XMessage) (dto.MessageID, bool) {
+	rawID, _ := entry.Values[fieldID].(string)
+	msg, _ := entry.Values[fieldMessage].(string)
+
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return dto.MessageID{}, false
+	}
+
+	return record_outbox.Unmarshal(id, []byte(msg)), true
+}
+
+// Peek возвращает самую старую не выданную этим экземпляром запись без ее извлечения. Если таких записей нет,
+// возвращает пустую структуру.
+func (rso *RedisStreamOutbox) Peek() dto.MessageID {
+	rso.mu.Lock()
+	defer rso.mu.Unlock()
+
+	entries, err := rso.client.XRangeN(context.Background(), rso.key(), "-", "+", int64(len(rso.leased)+1)).Result()
+	if err != nil {
+		return dto.MessageID{}
+	}
+
+	for _, entry := range entries {
+		if record, ok := parseEntry(entry); ok {
+			if _, leased := rso.leased[record.ID]; !leased {
+				return record
+			}
+		}
+	}
+
+	return dto.MessageID{}
+}
+
+// Ack удаляет из outbox'а выданные методом PopBatch записи с идентификаторами ids.
+func (rso *RedisStreamOutbox) Ack(ids ...uuid.UUID) error {
+	rso.mu.Lock()
+	defer rso.mu.Unlock()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, rso.name)
+	for _, id := range ids {
+		args = append(args, id.String())
+		delete(rso.leased, id)
+	}
+
+	return ackScript.Run(context.Background(), rso.client, rso.keys(), args...).Err()
+}
+
+// Nack возвращает выданные методом PopBatch записи с идентификаторами ids: они остаются в списке ожидающих
+// подтверждения этого потребителя и выдаются повторно при следующем вызове PopBatch раньше новых записей.
+func (rso *RedisStreamOutbox) Nack(ids ...uuid.UUID) error {
+	rso.mu.Lock()
+	defer rso.mu.Unlock()
+
+	for _, id := range ids {
+		delete(rso.leased, id)
+	}
+
+	return nil
+}
+
+// IsEmpty возвращает true, если в outbox'е нет записей этого экземпляра, в том числе выданных и не подтвержденных.
+func (rso *RedisStreamOutbox) IsEmpty() bool {
+	return rso.Len() == 0
+}
+
+// Contains возвращает true, если в outbox'е есть запись с идентификатором id.
+func (rso *RedisStreamOutbox) Contains(id uuid.UUID) bool {
+	return rso.client.HExists(context.Background(), rso.idsKey(), id.String()).Val()
+}
+
+// Len возвращает количество записей этого экземпляра в outbox'е, в том числе выданных и не подтвержденных. Записи
+// других экземпляров, еще не выданные этому, не учитываются.
+func (rso *RedisStreamOutbox) Len() int {
+	count, _ := rso.client.HGet(context.Background(), rso.depthKey(), rso.consumer).Int()
+
+	return count
+}
+
+// IsFull возвращает true, если outbox этого экземпляра заполнен.
+func (rso *RedisStreamOutbox) IsFull() bool {
+	return rso.capacity > 0 && rso.Len() >= rso.capacity
+}
+
+// Ping проверяет соединение с сервером Redis.
+func (rso *RedisStreamOutbox) Ping(ctx context.Context) error {
+	return rso.client.Ping(ctx).Err()
+}
+
+// key возвращает ключ потока, общего для всех экземпляров приложения.
+func (rso *RedisStreamOutbox) key() string {
+	return fmt.Sprintf("%s:%s", outboxPrefix, rso.name)
+}
+
+// idsKey возвращает ключ хэша, сопоставляющего идентификаторы сообщений идентификаторам элементов потока.
+func (rso *RedisStreamOutbox) idsKey() string {
+	return fmt.Sprintf("%s:%s", rso.key(), idsSuffix)
+}
+
+// ownersKey возвращает ключ хэша, сопоставляющего идентификаторы сообщений экземплярам-владельцам записей.
+func (rso *RedisStreamOutbox) ownersKey() string {
+	return fmt.Sprintf("%s:%s", rso.key(), ownersSuffix)
+}
+
+// depthKey возвращает ключ хэша с количеством записей каждого экземпляра.
+func (rso *RedisStreamOutbox) depthKey() string {
+	return fmt.Sprintf("%s:%s", rso.key(), depthSuffix)
+}
+
+// keys возвращает ключи потока и хэшей идентификаторов, владельцев и количества записей для передачи в скрипты.
+func (rso *RedisStreamOutbox) keys() []string {
+	return []string{rso.key(), rso.idsKey(), rso.ownersKey(), rso.depthKey()}
+}
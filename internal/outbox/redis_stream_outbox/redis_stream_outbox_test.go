@@ -0,0 +1,103 @@
+package redis_stream_outbox
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/outbox/contract"
+	"github.com/lazylex/messaggio/internal/outbox/redistest"
+	"github.com/lazylex/messaggio/internal/ports/record_outbox"
+	"testing"
+	"time"
+)
+
+func TestContract(t *testing.T) {
+	client := redistest.NewClient(t)
+	create := func() record_outbox.Interface {
+		return MustCreate(client, uuid.NewString(), "test", 0, time.Minute)
+	}
+
+	if err := contract.Verify(create); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddDuplicate(t *testing.T) {
+	rso := MustCreate(redistest.NewClient(t), "test", "test", 0, time.Minute)
+
+	record := dto.MessageID{ID: uuid.New(), Message: message.Message("message")}
+	for i := 0; i < 2; i++ {
+		if err := rso.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if rso.Len() != 1 {
+		t.Fatalf("expected 1 record, got %d", rso.Len())
+	}
+
+	batch := rso.PopBatch(10)
+	if len(batch) != 1 || batch[0].ID != record.ID {
+		t.Fatalf("expected record %s, got %+v", record.ID, batch)
+	}
+
+	if err := rso.Ack(record.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if !rso.IsEmpty() {
+		t.Fatalf("expected empty outbox after ack, got %d records", rso.Len())
+	}
+
+	if batch = rso.PopBatch(10); len(batch) != 0 {
+		t.Fatalf("expected no records after ack, got %d", len(batch))
+	}
+}
+
+func TestPerInstanceDepth(t *testing.T) {
+	client := redistest.NewClient(t)
+	first := MustCreate(client, "test", "first", 2, time.Minute)
+	second := MustCreate(client, "test", "second", 2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if err := first.Add(dto.MessageID{ID: uuid.New(), Message: message.Message("first")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := first.Add(dto.MessageID{ID: uuid.New(), Message: message.Message("first")})
+	if !errors.Is(err, record_outbox.ErrOutboxFull) {
+		t.Fatalf("expected %v, got %v", record_outbox.ErrOutboxFull, err)
+	}
+
+	if !second.IsEmpty() || second.IsFull() {
+		t.Fatalf("expected empty outbox of second instance, got %d records", second.Len())
+	}
+
+	if err := second.Add(dto.MessageID{ID: uuid.New(), Message: message.Message("second")}); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := second.PopBatch(10)
+	if len(batch) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(batch))
+	}
+
+	if first.Len() != 0 || second.Len() != 3 {
+		t.Fatalf("expected 0 and 3 records after lease, got %d and %d", first.Len(), second.Len())
+	}
+
+	ids := make([]uuid.UUID, 0, len(batch))
+	for _, record := range batch {
+		ids = append(ids, record.ID)
+	}
+
+	if err := second.Ack(ids...); err != nil {
+		t.Fatal(err)
+	}
+
+	if !first.IsEmpty() || !second.IsEmpty() {
+		t.Fatalf("expected empty outboxes after ack, got %d and %d records", first.Len(), second.Len())
+	}
+}
@@ -0,0 +1,32 @@
+/*
+Package redistest: вспомогательные функции для тестов реализаций интерфейса
+"github.com/lazylex/messaggio/internal/ports/record_outbox" на основе Redis.
+*/
+package redistest
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"testing"
+)
+
+// Run запускает тестовый сервер Redis, останавливаемый по завершении теста, и возвращает его вместе с клиентом,
+// закрываемым по завершении теста. Сервер позволяет управлять временем жизни ключей (например, FastForward).
+func Run(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return server, client
+}
+
+// NewClient возвращает клиент тестового сервера Redis, останавливаемого по завершении теста.
+func NewClient(t *testing.T) *redis.Client {
+	t.Helper()
+
+	_, client := Run(t)
+
+	return client
+}
@@ -0,0 +1,11 @@
+package health
+
+import (
+	"context"
+	"github.com/lazylex/messaggio/internal/dto"
+)
+
+//go:generate mockgen -source=health.go -destination=mocks/health.go
+type Interface interface {
+	Report(ctx context.Context) dto.Health
+}
@@ -33,6 +33,30 @@ func (m *MockMetricsInterface) EXPECT() *MockMetricsInterfaceMockRecorder {
 	return m.recorder
 }
 
+// CircuitBreakerState mocks base method.
+func (m *MockMetricsInterface) CircuitBreakerState(dependency string, state int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "CircuitBreakerState", dependency, state)
+}
+
+// CircuitBreakerState indicates an expected call of CircuitBreakerState.
+func (mr *MockMetricsInterfaceMockRecorder) CircuitBreakerState(dependency, state interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CircuitBreakerState", reflect.TypeOf((*MockMetricsInterface)(nil).CircuitBreakerState), dependency, state)
+}
+
+// ConfirmationInc mocks base method.
+func (m *MockMetricsInterface) ConfirmationInc(outcome string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ConfirmationInc", outcome)
+}
+
+// ConfirmationInc indicates an expected call of ConfirmationInc.
+func (mr *MockMetricsInterfaceMockRecorder) ConfirmationInc(outcome interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmationInc", reflect.TypeOf((*MockMetricsInterface)(nil).ConfirmationInc), outcome)
+}
+
 // IncomingMsgInc mocks base method.
 func (m *MockMetricsInterface) IncomingMsgInc() {
 	m.ctrl.T.Helper()
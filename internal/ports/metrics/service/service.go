@@ -5,4 +5,6 @@ type MetricsInterface interface {
 	IncomingMsgInc()
 	ProcessedMsgInc()
 	ProblemsSavingInDB()
+	ConfirmationInc(outcome string)
+	CircuitBreakerState(dependency string, state int)
 }
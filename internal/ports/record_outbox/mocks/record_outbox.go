@@ -8,6 +8,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	uuid "github.com/google/uuid"
 	dto "github.com/lazylex/messaggio/internal/dto"
 )
 
@@ -34,6 +35,24 @@ func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
 	return m.recorder
 }
 
+// Ack mocks base method.
+func (m *MockInterface) Ack(ids ...uuid.UUID) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range ids {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Ack", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ack indicates an expected call of Ack.
+func (mr *MockInterfaceMockRecorder) Ack(ids ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ack", reflect.TypeOf((*MockInterface)(nil).Ack), ids...)
+}
+
 // Add mocks base method.
 func (m *MockInterface) Add(arg0 dto.MessageID) error {
 	m.ctrl.T.Helper()
@@ -48,6 +67,20 @@ func (mr *MockInterfaceMockRecorder) Add(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockInterface)(nil).Add), arg0)
 }
 
+// Contains mocks base method.
+func (m *MockInterface) Contains(arg0 uuid.UUID) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Contains", arg0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Contains indicates an expected call of Contains.
+func (mr *MockInterfaceMockRecorder) Contains(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Contains", reflect.TypeOf((*MockInterface)(nil).Contains), arg0)
+}
+
 // IsEmpty mocks base method.
 func (m *MockInterface) IsEmpty() bool {
 	m.ctrl.T.Helper()
@@ -62,6 +95,66 @@ func (mr *MockInterfaceMockRecorder) IsEmpty() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsEmpty", reflect.TypeOf((*MockInterface)(nil).IsEmpty))
 }
 
+// IsFull mocks base method.
+func (m *MockInterface) IsFull() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsFull")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsFull indicates an expected call of IsFull.
+func (mr *MockInterfaceMockRecorder) IsFull() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsFull", reflect.TypeOf((*MockInterface)(nil).IsFull))
+}
+
+// Len mocks base method.
+func (m *MockInterface) Len() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Len")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Len indicates an expected call of Len.
+func (mr *MockInterfaceMockRecorder) Len() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Len", reflect.TypeOf((*MockInterface)(nil).Len))
+}
+
+// Nack mocks base method.
+func (m *MockInterface) Nack(ids ...uuid.UUID) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range ids {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Nack", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Nack indicates an expected call of Nack.
+func (mr *MockInterfaceMockRecorder) Nack(ids ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Nack", reflect.TypeOf((*MockInterface)(nil).Nack), ids...)
+}
+
+// Peek mocks base method.
+func (m *MockInterface) Peek() dto.MessageID {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Peek")
+	ret0, _ := ret[0].(dto.MessageID)
+	return ret0
+}
+
+// Peek indicates an expected call of Peek.
+func (mr *MockInterfaceMockRecorder) Peek() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Peek", reflect.TypeOf((*MockInterface)(nil).Peek))
+}
+
 // Pop mocks base method.
 func (m *MockInterface) Pop() dto.MessageID {
 	m.ctrl.T.Helper()
@@ -75,3 +168,17 @@ func (mr *MockInterfaceMockRecorder) Pop() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pop", reflect.TypeOf((*MockInterface)(nil).Pop))
 }
+
+// PopBatch mocks base method.
+func (m *MockInterface) PopBatch(count int) []dto.MessageID {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PopBatch", count)
+	ret0, _ := ret[0].([]dto.MessageID)
+	return ret0
+}
+
+// PopBatch indicates an expected call of PopBatch.
+func (mr *MockInterfaceMockRecorder) PopBatch(count interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PopBatch", reflect.TypeOf((*MockInterface)(nil).PopBatch), count)
+}
@@ -0,0 +1,61 @@
+package record_outbox
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	"github.com/lazylex/messaggio/internal/dto"
+	"time"
+)
+
+const recordVersion = 1
+
+// record запись outbox'а вместе с метаданными сообщения в виде, сохраняемом долговременными реализациями outbox'а.
+type record struct {
+	Version        int             `json:"version"`
+	ID             uuid.UUID       `json:"id"`
+	Message        message.Message `json:"message"`
+	IdempotencyKey string          `json:"idempotency_key,omitempty"`
+	Attempt        int             `json:"attempt,omitempty"`
+	RoutingKey     string          `json:"routing_key,omitempty"`
+	TraceParent    string          `json:"trace_parent,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// Marshal возвращает запись data вместе с метаданными сообщения (ключом идемпотентности, номером повторной отправки,
+// ключом маршрутизации, контекстом трассировки и временем приема) для сохранения долговременными реализациями
+// outbox'а.
+func Marshal(data dto.MessageID) []byte {
+	// структура не содержит типов, сериализация которых может завершиться ошибкой
+	result, _ := json.Marshal(record{
+		Version:        recordVersion,
+		ID:             data.ID,
+		Message:        data.Message,
+		IdempotencyKey: data.IdempotencyKey,
+		Attempt:        data.Attempt,
+		RoutingKey:     data.RoutingKey,
+		TraceParent:    data.TraceParent,
+		CreatedAt:      data.CreatedAt,
+	})
+
+	return result
+}
+
+// Unmarshal восстанавливает запись с идентификатором id из данных, сохраненных функцией Marshal. Данные, сохраненные
+// предыдущими версиями приложения без метаданных, возвращаются в качестве сообщения записи.
+func Unmarshal(id uuid.UUID, data []byte) dto.MessageID {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil || r.Version != recordVersion || r.ID != id {
+		return dto.MessageID{ID: id, Message: data}
+	}
+
+	return dto.MessageID{
+		Message:        r.Message,
+		ID:             r.ID,
+		IdempotencyKey: r.IdempotencyKey,
+		Attempt:        r.Attempt,
+		RoutingKey:     r.RoutingKey,
+		TraceParent:    r.TraceParent,
+		CreatedAt:      r.CreatedAt,
+	}
+}
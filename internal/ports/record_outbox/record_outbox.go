@@ -1,10 +1,28 @@
 package record_outbox
 
-import "github.com/lazylex/messaggio/internal/dto"
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/dto"
+)
 
+var ErrOutboxFull = errors.New("outbox is full")
+
+// Interface outbox для временного хранения сообщений. Реализации должны извлекать записи методами Pop и PopBatch в
+// порядке их добавления методом Add (FIFO), что проверяется функцией contract.Verify. Pop удаляет запись сразу, записи,
+// выданные PopBatch, удаляются только после подтверждения методом Ack, а при вызове Nack возвращаются в начало очереди.
+// Len и IsEmpty учитывают выданные и не подтвержденные записи.
+//
 //go:generate mockgen -source=record_outbox.go -destination=mocks/record_outbox.go
 type Interface interface {
 	Add(dto.MessageID) error
 	Pop() dto.MessageID
+	PopBatch(count int) []dto.MessageID
+	Peek() dto.MessageID
+	Ack(ids ...uuid.UUID) error
+	Nack(ids ...uuid.UUID) error
 	IsEmpty() bool
+	Contains(uuid.UUID) bool
+	Len() int
+	IsFull() bool
 }
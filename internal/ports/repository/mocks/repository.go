@@ -7,9 +7,11 @@ package mock_repository
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	uuid "github.com/google/uuid"
+	status "github.com/lazylex/messaggio/internal/domain/value_objects/status"
 	dto "github.com/lazylex/messaggio/internal/dto"
 )
 
@@ -36,6 +38,110 @@ func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
 	return m.recorder
 }
 
+// ClaimStuckMessages mocks base method.
+func (m *MockInterface) ClaimStuckMessages(ctx context.Context, olderThan time.Duration, maxAttempts, limit int) ([]dto.MessageID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimStuckMessages", ctx, olderThan, maxAttempts, limit)
+	ret0, _ := ret[0].([]dto.MessageID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimStuckMessages indicates an expected call of ClaimStuckMessages.
+func (mr *MockInterfaceMockRecorder) ClaimStuckMessages(ctx, olderThan, maxAttempts, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimStuckMessages", reflect.TypeOf((*MockInterface)(nil).ClaimStuckMessages), ctx, olderThan, maxAttempts, limit)
+}
+
+// FailStuckMessages mocks base method.
+func (m *MockInterface) FailStuckMessages(ctx context.Context, olderThan time.Duration, maxAttempts int) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailStuckMessages", ctx, olderThan, maxAttempts)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FailStuckMessages indicates an expected call of FailStuckMessages.
+func (mr *MockInterfaceMockRecorder) FailStuckMessages(ctx, olderThan, maxAttempts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailStuckMessages", reflect.TypeOf((*MockInterface)(nil).FailStuckMessages), ctx, olderThan, maxAttempts)
+}
+
+// IDByIdempotencyKey mocks base method.
+func (m *MockInterface) IDByIdempotencyKey(ctx context.Context, key string, window time.Duration) (uuid.UUID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IDByIdempotencyKey", ctx, key, window)
+	ret0, _ := ret[0].(uuid.UUID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IDByIdempotencyKey indicates an expected call of IDByIdempotencyKey.
+func (mr *MockInterfaceMockRecorder) IDByIdempotencyKey(ctx, key, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IDByIdempotencyKey", reflect.TypeOf((*MockInterface)(nil).IDByIdempotencyKey), ctx, key, window)
+}
+
+// MessageInfo mocks base method.
+func (m *MockInterface) MessageInfo(ctx context.Context, id uuid.UUID) (dto.MessageInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MessageInfo", ctx, id)
+	ret0, _ := ret[0].(dto.MessageInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MessageInfo indicates an expected call of MessageInfo.
+func (mr *MockInterfaceMockRecorder) MessageInfo(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MessageInfo", reflect.TypeOf((*MockInterface)(nil).MessageInfo), ctx, id)
+}
+
+// MessageMetadata mocks base method.
+func (m *MockInterface) MessageMetadata(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]dto.MessageMetadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MessageMetadata", ctx, ids)
+	ret0, _ := ret[0].(map[uuid.UUID]dto.MessageMetadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MessageMetadata indicates an expected call of MessageMetadata.
+func (mr *MockInterfaceMockRecorder) MessageMetadata(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MessageMetadata", reflect.TypeOf((*MockInterface)(nil).MessageMetadata), ctx, ids)
+}
+
+// Messages mocks base method.
+func (m *MockInterface) Messages(ctx context.Context, filter dto.MessageFilter) ([]dto.MessageInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Messages", ctx, filter)
+	ret0, _ := ret[0].([]dto.MessageInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Messages indicates an expected call of Messages.
+func (mr *MockInterfaceMockRecorder) Messages(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Messages", reflect.TypeOf((*MockInterface)(nil).Messages), ctx, filter)
+}
+
+// Ping mocks base method.
+func (m *MockInterface) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockInterfaceMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockInterface)(nil).Ping), ctx)
+}
+
 // ProcessedCount mocks base method.
 func (m *MockInterface) ProcessedCount(ctx context.Context) (dto.Processed, error) {
 	m.ctrl.T.Helper()
@@ -51,6 +157,35 @@ func (mr *MockInterfaceMockRecorder) ProcessedCount(ctx interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessedCount", reflect.TypeOf((*MockInterface)(nil).ProcessedCount), ctx)
 }
 
+// ReleaseIdempotencyKey mocks base method.
+func (m *MockInterface) ReleaseIdempotencyKey(ctx context.Context, key string, window time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseIdempotencyKey", ctx, key, window)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseIdempotencyKey indicates an expected call of ReleaseIdempotencyKey.
+func (mr *MockInterfaceMockRecorder) ReleaseIdempotencyKey(ctx, key, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseIdempotencyKey", reflect.TypeOf((*MockInterface)(nil).ReleaseIdempotencyKey), ctx, key, window)
+}
+
+// RequeueDeadLettered mocks base method.
+func (m *MockInterface) RequeueDeadLettered(ctx context.Context, id uuid.UUID) (dto.MessageID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequeueDeadLettered", ctx, id)
+	ret0, _ := ret[0].(dto.MessageID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequeueDeadLettered indicates an expected call of RequeueDeadLettered.
+func (mr *MockInterfaceMockRecorder) RequeueDeadLettered(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueDeadLettered", reflect.TypeOf((*MockInterface)(nil).RequeueDeadLettered), ctx, id)
+}
+
 // SaveMessage mocks base method.
 func (m *MockInterface) SaveMessage(ctx context.Context, data dto.MessageID) error {
 	m.ctrl.T.Helper()
@@ -65,16 +200,44 @@ func (mr *MockInterfaceMockRecorder) SaveMessage(ctx, data interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveMessage", reflect.TypeOf((*MockInterface)(nil).SaveMessage), ctx, data)
 }
 
+// SaveMessages mocks base method.
+func (m *MockInterface) SaveMessages(ctx context.Context, data []dto.MessageID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveMessages", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveMessages indicates an expected call of SaveMessages.
+func (mr *MockInterfaceMockRecorder) SaveMessages(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveMessages", reflect.TypeOf((*MockInterface)(nil).SaveMessages), ctx, data)
+}
+
 // UpdateStatus mocks base method.
-func (m *MockInterface) UpdateStatus(ctx context.Context, id uuid.UUID) error {
+func (m *MockInterface) UpdateStatus(ctx context.Context, id uuid.UUID, to status.Status, from []status.Status, details dto.StatusDetails) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateStatus", ctx, id)
+	ret := m.ctrl.Call(m, "UpdateStatus", ctx, id, to, from, details)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateStatus indicates an expected call of UpdateStatus.
-func (mr *MockInterfaceMockRecorder) UpdateStatus(ctx, id interface{}) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) UpdateStatus(ctx, id, to, from, details interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatus", reflect.TypeOf((*MockInterface)(nil).UpdateStatus), ctx, id, to, from, details)
+}
+
+// UpdateStatuses mocks base method.
+func (m *MockInterface) UpdateStatuses(ctx context.Context, ids []uuid.UUID, to status.Status, from []status.Status) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateStatuses", ctx, ids, to, from)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateStatuses indicates an expected call of UpdateStatuses.
+func (mr *MockInterfaceMockRecorder) UpdateStatuses(ctx, ids, to, from interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatus", reflect.TypeOf((*MockInterface)(nil).UpdateStatus), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatuses", reflect.TypeOf((*MockInterface)(nil).UpdateStatuses), ctx, ids, to, from)
 }
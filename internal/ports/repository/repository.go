@@ -4,16 +4,31 @@ import (
 	"context"
 	"errors"
 	"github.com/google/uuid"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/status"
 	"github.com/lazylex/messaggio/internal/dto"
+	"time"
 )
 
 var (
-	ErrDuplicateKeyValue = errors.New("duplicate key value violates unique constraint violation")
+	ErrDuplicateKeyValue     = errors.New("duplicate key value violates unique constraint violation")
+	ErrNotFound              = errors.New("record not found")
+	ErrIdempotencyKeyExpired = errors.New("idempotency key expired")
 )
 
 //go:generate mockgen -source=repository.go -destination=mocks/repository.go
 type Interface interface {
 	SaveMessage(ctx context.Context, data dto.MessageID) error
-	UpdateStatus(ctx context.Context, id uuid.UUID) error
+	SaveMessages(ctx context.Context, data []dto.MessageID) error
+	UpdateStatus(ctx context.Context, id uuid.UUID, to status.Status, from []status.Status, details dto.StatusDetails) error
+	UpdateStatuses(ctx context.Context, ids []uuid.UUID, to status.Status, from []status.Status) error
 	ProcessedCount(ctx context.Context) (dto.Processed, error)
+	MessageInfo(ctx context.Context, id uuid.UUID) (dto.MessageInfo, error)
+	Messages(ctx context.Context, filter dto.MessageFilter) ([]dto.MessageInfo, error)
+	IDByIdempotencyKey(ctx context.Context, key string, window time.Duration) (uuid.UUID, error)
+	ReleaseIdempotencyKey(ctx context.Context, key string, window time.Duration) error
+	MessageMetadata(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]dto.MessageMetadata, error)
+	FailStuckMessages(ctx context.Context, olderThan time.Duration, maxAttempts int) (int64, error)
+	ClaimStuckMessages(ctx context.Context, olderThan time.Duration, maxAttempts, limit int) ([]dto.MessageID, error)
+	RequeueDeadLettered(ctx context.Context, id uuid.UUID) (dto.MessageID, error)
+	Ping(ctx context.Context) error
 }
@@ -11,7 +11,9 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	uuid "github.com/google/uuid"
 	message "github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	status "github.com/lazylex/messaggio/internal/domain/value_objects/status"
 	dto "github.com/lazylex/messaggio/internal/dto"
+	retry "github.com/lazylex/messaggio/internal/retry"
 )
 
 // MockInterface is a mock of Interface interface.
@@ -37,6 +39,76 @@ func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
 	return m.recorder
 }
 
+// BrokerBreaker mocks base method.
+func (m *MockInterface) BrokerBreaker() *retry.Breaker {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BrokerBreaker")
+	ret0, _ := ret[0].(*retry.Breaker)
+	return ret0
+}
+
+// BrokerBreaker indicates an expected call of BrokerBreaker.
+func (mr *MockInterfaceMockRecorder) BrokerBreaker() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BrokerBreaker", reflect.TypeOf((*MockInterface)(nil).BrokerBreaker))
+}
+
+// ChangeStatus mocks base method.
+func (m *MockInterface) ChangeStatus(ctx context.Context, id uuid.UUID, target status.Status) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeStatus", ctx, id, target)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangeStatus indicates an expected call of ChangeStatus.
+func (mr *MockInterfaceMockRecorder) ChangeStatus(ctx, id, target interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeStatus", reflect.TypeOf((*MockInterface)(nil).ChangeStatus), ctx, id, target)
+}
+
+// CheckCapacity mocks base method.
+func (m *MockInterface) CheckCapacity() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckCapacity")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckCapacity indicates an expected call of CheckCapacity.
+func (mr *MockInterfaceMockRecorder) CheckCapacity() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckCapacity", reflect.TypeOf((*MockInterface)(nil).CheckCapacity))
+}
+
+// ConfirmMessage mocks base method.
+func (m *MockInterface) ConfirmMessage(ctx context.Context, id uuid.UUID, outcome status.Status, details dto.StatusDetails) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmMessage", ctx, id, outcome, details)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmMessage indicates an expected call of ConfirmMessage.
+func (mr *MockInterfaceMockRecorder) ConfirmMessage(ctx, id, outcome, details interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmMessage", reflect.TypeOf((*MockInterface)(nil).ConfirmMessage), ctx, id, outcome, details)
+}
+
+// DeadLetterMessage mocks base method.
+func (m *MockInterface) DeadLetterMessage(ctx context.Context, id uuid.UUID, details dto.StatusDetails) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeadLetterMessage", ctx, id, details)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeadLetterMessage indicates an expected call of DeadLetterMessage.
+func (mr *MockInterfaceMockRecorder) DeadLetterMessage(ctx, id, details interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeadLetterMessage", reflect.TypeOf((*MockInterface)(nil).DeadLetterMessage), ctx, id, details)
+}
+
 // MarkMessageAsProcessed mocks base method.
 func (m *MockInterface) MarkMessageAsProcessed(ctx context.Context, id uuid.UUID) error {
 	m.ctrl.T.Helper()
@@ -51,6 +123,20 @@ func (mr *MockInterfaceMockRecorder) MarkMessageAsProcessed(ctx, id interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkMessageAsProcessed", reflect.TypeOf((*MockInterface)(nil).MarkMessageAsProcessed), ctx, id)
 }
 
+// MarkSent mocks base method.
+func (m *MockInterface) MarkSent(ctx context.Context, ids []uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkSent", ctx, ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkSent indicates an expected call of MarkSent.
+func (mr *MockInterfaceMockRecorder) MarkSent(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkSent", reflect.TypeOf((*MockInterface)(nil).MarkSent), ctx, ids)
+}
+
 // MessageChan mocks base method.
 func (m *MockInterface) MessageChan() chan dto.MessageID {
 	m.ctrl.T.Helper()
@@ -65,19 +151,63 @@ func (mr *MockInterfaceMockRecorder) MessageChan() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MessageChan", reflect.TypeOf((*MockInterface)(nil).MessageChan))
 }
 
+// MessageInfo mocks base method.
+func (m *MockInterface) MessageInfo(ctx context.Context, id uuid.UUID) (dto.MessageInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MessageInfo", ctx, id)
+	ret0, _ := ret[0].(dto.MessageInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MessageInfo indicates an expected call of MessageInfo.
+func (mr *MockInterfaceMockRecorder) MessageInfo(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MessageInfo", reflect.TypeOf((*MockInterface)(nil).MessageInfo), ctx, id)
+}
+
+// Messages mocks base method.
+func (m *MockInterface) Messages(ctx context.Context, filter dto.MessageFilter) (dto.MessageList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Messages", ctx, filter)
+	ret0, _ := ret[0].(dto.MessageList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Messages indicates an expected call of Messages.
+func (mr *MockInterfaceMockRecorder) Messages(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Messages", reflect.TypeOf((*MockInterface)(nil).Messages), ctx, filter)
+}
+
 // ProcessMessage mocks base method.
-func (m *MockInterface) ProcessMessage(ctx context.Context, msg message.Message) (uuid.UUID, error) {
+func (m *MockInterface) ProcessMessage(ctx context.Context, msg message.Message, idempotencyKey, routingKey string) (uuid.UUID, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ProcessMessage", ctx, msg)
+	ret := m.ctrl.Call(m, "ProcessMessage", ctx, msg, idempotencyKey, routingKey)
 	ret0, _ := ret[0].(uuid.UUID)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // ProcessMessage indicates an expected call of ProcessMessage.
-func (mr *MockInterfaceMockRecorder) ProcessMessage(ctx, msg interface{}) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) ProcessMessage(ctx, msg, idempotencyKey, routingKey interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessMessage", reflect.TypeOf((*MockInterface)(nil).ProcessMessage), ctx, msg)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessMessage", reflect.TypeOf((*MockInterface)(nil).ProcessMessage), ctx, msg, idempotencyKey, routingKey)
+}
+
+// ProcessMessages mocks base method.
+func (m *MockInterface) ProcessMessages(ctx context.Context, msgs []message.Message) []dto.ProcessResult {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProcessMessages", ctx, msgs)
+	ret0, _ := ret[0].([]dto.ProcessResult)
+	return ret0
+}
+
+// ProcessMessages indicates an expected call of ProcessMessages.
+func (mr *MockInterfaceMockRecorder) ProcessMessages(ctx, msgs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessMessages", reflect.TypeOf((*MockInterface)(nil).ProcessMessages), ctx, msgs)
 }
 
 // ProcessedCountStatistic mocks base method.
@@ -95,6 +225,34 @@ func (mr *MockInterfaceMockRecorder) ProcessedCountStatistic(ctx interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessedCountStatistic", reflect.TypeOf((*MockInterface)(nil).ProcessedCountStatistic), ctx)
 }
 
+// RedriveMessage mocks base method.
+func (m *MockInterface) RedriveMessage(ctx context.Context, id uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RedriveMessage", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RedriveMessage indicates an expected call of RedriveMessage.
+func (mr *MockInterfaceMockRecorder) RedriveMessage(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RedriveMessage", reflect.TypeOf((*MockInterface)(nil).RedriveMessage), ctx, id)
+}
+
+// SaveStatusUpdate mocks base method.
+func (m *MockInterface) SaveStatusUpdate(update dto.StatusUpdate) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveStatusUpdate", update)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveStatusUpdate indicates an expected call of SaveStatusUpdate.
+func (mr *MockInterfaceMockRecorder) SaveStatusUpdate(update interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveStatusUpdate", reflect.TypeOf((*MockInterface)(nil).SaveStatusUpdate), update)
+}
+
 // SaveUnsentMessage mocks base method.
 func (m *MockInterface) SaveUnsentMessage(arg0 dto.MessageID) error {
 	m.ctrl.T.Helper()
@@ -5,21 +5,50 @@ import (
 	"errors"
 	"github.com/google/uuid"
 	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/status"
 	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/retry"
+)
+
+const (
+	ResultSaved              = "saved, sent to the broker..." // Сообщение сохранено в БД и передано на отправку в брокер
+	ResultTemporallyNotSaved = "temporally problem to save"   // Сообщение сохранено для повторной попытки записи в БД
+	ResultRejected           = "rejected"                     // Сообщение не принято в обработку
+	ResultDuplicate          = "already accepted"             // Сообщение с тем же ключом идемпотентности уже принято
 )
 
 var (
 	ErrSavingToRepository       = errors.New("service: failed to save to repository")
 	ErrUpdateStatusInRepository = errors.New("service: failed to update status in repository")
+	ErrInvalidTransition        = errors.New("service: invalid message status transition")
+	ErrInvalidStatus            = errors.New("service: invalid message status")
 	ErrSavingToRepoRecordOutbox = errors.New("service: failed to save to repository record outbox")
+	ErrMessageNotFound          = errors.New("service: message not found")
+	ErrEmptyMessage             = errors.New("service: empty message")
+	ErrNoBrokerRecordOutbox     = errors.New("service: broker record outbox is not used")
+	ErrDuplicateRequest         = errors.New("service: message with the same idempotency key already accepted")
+	ErrBrokerOutboxFull         = errors.New("service: broker record outbox is full")
+	ErrRepoOutboxFull           = errors.New("service: repository record outbox is full")
+	ErrNotDeadLettered          = errors.New("service: message is not dead-lettered")
 )
 
 //go:generate mockgen -source=service.go -destination=mocks/service.go
 type Interface interface {
-	ProcessMessage(ctx context.Context, msg message.Message) (uuid.UUID, error)
+	ProcessMessage(ctx context.Context, msg message.Message, idempotencyKey, routingKey string) (uuid.UUID, error)
+	ProcessMessages(ctx context.Context, msgs []message.Message) []dto.ProcessResult
+	CheckCapacity() error
 	MarkMessageAsProcessed(ctx context.Context, id uuid.UUID) error
+	ChangeStatus(ctx context.Context, id uuid.UUID, target status.Status) error
+	MarkSent(ctx context.Context, ids []uuid.UUID) error
+	ConfirmMessage(ctx context.Context, id uuid.UUID, outcome status.Status, details dto.StatusDetails) error
 	MessageChan() chan dto.MessageID
 	SaveUnsentMessage(dto.MessageID) error
+	SaveStatusUpdate(update dto.StatusUpdate) error
+	DeadLetterMessage(ctx context.Context, id uuid.UUID, details dto.StatusDetails) error
+	RedriveMessage(ctx context.Context, id uuid.UUID) error
 	Statistic() dto.Statistic
 	ProcessedCountStatistic(ctx context.Context) (dto.Processed, error)
+	MessageInfo(ctx context.Context, id uuid.UUID) (dto.MessageInfo, error)
+	Messages(ctx context.Context, filter dto.MessageFilter) (dto.MessageList, error)
+	BrokerBreaker() *retry.Breaker
 }
@@ -0,0 +1,81 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: transactional_outbox.go
+
+// Package mock_transactional_outbox is a generated GoMock package.
+package mock_transactional_outbox
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+	dto "github.com/lazylex/messaggio/internal/dto"
+)
+
+// MockInterface is a mock of Interface interface.
+type MockInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockInterfaceMockRecorder
+}
+
+// MockInterfaceMockRecorder is the mock recorder for MockInterface.
+type MockInterfaceMockRecorder struct {
+	mock *MockInterface
+}
+
+// NewMockInterface creates a new mock instance.
+func NewMockInterface(ctrl *gomock.Controller) *MockInterface {
+	mock := &MockInterface{ctrl: ctrl}
+	mock.recorder = &MockInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
+	return m.recorder
+}
+
+// ClaimOutboxRecords mocks base method.
+func (m *MockInterface) ClaimOutboxRecords(ctx context.Context, limit int, claimTimeout time.Duration) ([]dto.OutboxRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimOutboxRecords", ctx, limit, claimTimeout)
+	ret0, _ := ret[0].([]dto.OutboxRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimOutboxRecords indicates an expected call of ClaimOutboxRecords.
+func (mr *MockInterfaceMockRecorder) ClaimOutboxRecords(ctx, limit, claimTimeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimOutboxRecords", reflect.TypeOf((*MockInterface)(nil).ClaimOutboxRecords), ctx, limit, claimTimeout)
+}
+
+// DeleteOutboxRecords mocks base method.
+func (m *MockInterface) DeleteOutboxRecords(ctx context.Context, ids []int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOutboxRecords", ctx, ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteOutboxRecords indicates an expected call of DeleteOutboxRecords.
+func (mr *MockInterfaceMockRecorder) DeleteOutboxRecords(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOutboxRecords", reflect.TypeOf((*MockInterface)(nil).DeleteOutboxRecords), ctx, ids)
+}
+
+// PendingOutboxCount mocks base method.
+func (m *MockInterface) PendingOutboxCount(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PendingOutboxCount", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PendingOutboxCount indicates an expected call of PendingOutboxCount.
+func (mr *MockInterfaceMockRecorder) PendingOutboxCount(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PendingOutboxCount", reflect.TypeOf((*MockInterface)(nil).PendingOutboxCount), ctx)
+}
@@ -0,0 +1,14 @@
+package transactional_outbox
+
+import (
+	"context"
+	"github.com/lazylex/messaggio/internal/dto"
+	"time"
+)
+
+//go:generate mockgen -source=transactional_outbox.go -destination=mocks/transactional_outbox.go
+type Interface interface {
+	ClaimOutboxRecords(ctx context.Context, limit int, claimTimeout time.Duration) ([]dto.OutboxRecord, error)
+	DeleteOutboxRecords(ctx context.Context, ids []int64) error
+	PendingOutboxCount(ctx context.Context) (int, error)
+}
@@ -10,6 +10,7 @@ package postgresql
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx"
@@ -20,18 +21,24 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"time"
 )
 
-// PostgreSQL структура, хранящая пул соединений, их максимальное количество и текущую схему базы данных.
+// PostgreSQL структура, хранящая пул соединений, их максимальное количество, текущую схему базы данных и идентификатор
+// экземпляра приложения.
 type PostgreSQL struct {
-	pool           *pgx.ConnPool // Пул соединений
-	maxConnections int           // Максимально доступное количество соединений с БД
-	schema         string        // Схема базы данных
+	pool                *pgx.ConnPool // Пул соединений
+	maxConnections      int           // Максимально доступное количество соединений с БД
+	schema              string        // Схема базы данных
+	instance            string        // Уникальный идентификатор экземпляра приложения, сохраняемый вместе с сообщениями
+	transactionalOutbox bool          // Флаг сохранения записей транзакционного outbox'а в одной транзакции с сообщениями
+	queryTimeout        time.Duration // Максимальное время выполнения запроса к БД
 }
 
-// MustCreate возвращает структуру для взаимодействия с базой данных в СУБД PostgreSQL. В случае ошибки завершает
+// MustCreate возвращает структуру для взаимодействия с базой данных в СУБД PostgreSQL. При transactionalOutbox равном
+// true сохранение сообщений сопровождается созданием записей в транзакционном outbox'е. В случае ошибки завершает
 // работу всего приложения.
-func MustCreate(cfg config.PersistentStorage) *PostgreSQL {
+func MustCreate(cfg config.PersistentStorage, instance string, transactionalOutbox bool) *PostgreSQL {
 	schema := "public"
 	if len(cfg.DatabaseSchema) > 0 {
 		schema = pgx.Identifier{cfg.DatabaseSchema}.Sanitize()
@@ -44,7 +51,7 @@ func MustCreate(cfg config.PersistentStorage) *PostgreSQL {
 			Database:      cfg.DatabaseName,
 			User:          cfg.DatabaseLogin,
 			Password:      cfg.DatabasePassword,
-			RuntimeParams: map[string]string{"search_path": schema},
+			RuntimeParams: map[string]string{"search_path": schema, "application_name": instance},
 		},
 		MaxConnections: cfg.DatabaseMaxOpenConnections,
 	})
@@ -56,7 +63,14 @@ func MustCreate(cfg config.PersistentStorage) *PostgreSQL {
 		slog.Info("successfully create connection poll to postgres DB")
 	}
 
-	client := &PostgreSQL{pool: pool, maxConnections: cfg.DatabaseMaxOpenConnections, schema: schema}
+	client := &PostgreSQL{
+		pool:                pool,
+		maxConnections:      cfg.DatabaseMaxOpenConnections,
+		schema:              schema,
+		instance:            instance,
+		transactionalOutbox: transactionalOutbox,
+		queryTimeout:        cfg.QueryTimeout,
+	}
 
 	if err = client.createNotExistedSchemaAndTables(); err != nil {
 		slog.Error(err.Error())
@@ -66,6 +80,36 @@ func MustCreate(cfg config.PersistentStorage) *PostgreSQL {
 	return client
 }
 
+// withQueryTimeout возвращает контекст, ограниченный максимальным временем выполнения запроса к БД (если оно задано) и
+// сроком исходного контекста ctx.
+func (p *PostgreSQL) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, p.queryTimeout)
+}
+
+// Ping проверяет доступность СУБД, выполняя запрос на одном из соединений пула.
+func (p *PostgreSQL) Ping(ctx context.Context) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	conn, err := p.pool.AcquireEx(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.pool.Release(conn)
+
+	return conn.Ping(ctx)
+}
+
+// Close закрывает все соединения пула, дожидаясь освобождения занятых соединений.
+func (p *PostgreSQL) Close() {
+	p.pool.Close()
+	slog.Info("connection pool to postgres DB closed")
+}
+
 // createNotExistedSchemaAndTables создает схему и таблицы в БД, если они отсутствуют.
 func (p *PostgreSQL) createNotExistedSchemaAndTables() error {
 	var stmt string
@@ -89,6 +133,12 @@ func (p *PostgreSQL) createNotExistedSchemaAndTables() error {
 		return err
 	}
 
+	for _, st := range status.All {
+		if _, err := p.pool.Exec(fmt.Sprintf("ALTER TYPE msg_status ADD VALUE IF NOT EXISTS '%s';", st)); err != nil {
+			return err
+		}
+	}
+
 	stmt = `
 	CREATE TABLE IF NOT EXISTS messages 
 		(	
@@ -102,6 +152,78 @@ func (p *PostgreSQL) createNotExistedSchemaAndTables() error {
 		return err
 	}
 
+	stmt = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS instance TEXT;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS idempotency_key TEXT;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS error_code TEXT;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS error_reason TEXT;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS routing_key TEXT;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS traceparent TEXT;
+	CREATE UNIQUE INDEX IF NOT EXISTS messages_idempotency_key_idx ON messages (idempotency_key);
+
+	CREATE TABLE IF NOT EXISTS message_outbox
+		(
+			id BIGSERIAL PRIMARY KEY,
+			message_id UUID NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+			instance TEXT NOT NULL,
+			created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT now(),
+			claimed_at TIMESTAMP WITHOUT TIME ZONE
+		);
+	CREATE INDEX IF NOT EXISTS message_outbox_instance_idx ON message_outbox (instance, id);
+	CREATE INDEX IF NOT EXISTS messages_created_at_id_idx ON messages (created_at, id);
+	CREATE INDEX IF NOT EXISTS messages_status_created_at_idx ON messages (status, created_at);`
+
+	if _, err := p.pool.Exec(stmt); err != nil {
+		return err
+	}
+
+	stmt = `
+	CREATE TABLE IF NOT EXISTS message_status_history
+		(
+			id BIGSERIAL PRIMARY KEY,
+			message_id UUID NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+			from_status msg_status,
+			to_status msg_status NOT NULL,
+			instance TEXT,
+			changed_at TIMESTAMP WITHOUT TIME ZONE DEFAULT now()
+		);
+	CREATE INDEX IF NOT EXISTS message_status_history_message_id_idx ON message_status_history (message_id, id);
+
+	CREATE OR REPLACE FUNCTION record_status_transition()
+	RETURNS TRIGGER AS $$
+	BEGIN
+		IF TG_OP = 'INSERT' THEN
+			INSERT INTO message_status_history (message_id, from_status, to_status, instance)
+			VALUES (NEW.id, NULL, NEW.status, NULLIF(current_setting('application_name', true), ''));
+		ELSIF NEW.status IS DISTINCT FROM OLD.status THEN
+			INSERT INTO message_status_history (message_id, from_status, to_status, instance)
+			VALUES (NEW.id, OLD.status, NEW.status, NULLIF(current_setting('application_name', true), ''));
+		END IF;
+		RETURN NEW;
+	END;
+	$$ language 'plpgsql';
+
+	DO
+	$$
+	BEGIN
+		IF NOT EXISTS(SELECT *
+							 FROM information_schema.triggers
+							 WHERE event_object_table = 'messages'
+							 AND trigger_name = 'record_messages_status_transition'
+							 )
+		THEN
+			CREATE TRIGGER record_messages_status_transition
+			AFTER INSERT OR UPDATE OF status ON messages
+			FOR EACH ROW EXECUTE FUNCTION record_status_transition();
+		END IF ;
+	END;
+	$$;`
+
+	if _, err := p.pool.Exec(stmt); err != nil {
+		return err
+	}
+
 	stmt = `
 	CREATE OR REPLACE FUNCTION update_modified_column()
 	RETURNS TRIGGER AS $$
@@ -134,32 +256,211 @@ func (p *PostgreSQL) createNotExistedSchemaAndTables() error {
 	return nil
 }
 
-// SaveMessage сохраняет сообщение и его идентификатор в БД. Статус сообщения сохраняется по умолчанию
-// (status.InProcessing).
+// SaveMessage сохраняет сообщение, его идентификатор, ключ идемпотентности (если он задан) и идентификатор экземпляра
+// приложения в БД. Статус сообщения сохраняется по умолчанию (status.InProcessing).
 func (p *PostgreSQL) SaveMessage(ctx context.Context, data dto.MessageID) error {
-	stmt := `INSERT INTO messages (id, message) values ($1, $2);`
-	_, err := p.pool.ExecEx(ctx, stmt, nil, data.ID, data.Message)
+	return p.SaveMessages(ctx, []dto.MessageID{data})
+}
+
+// SaveMessages сохраняет пакет сообщений в БД одним запросом. Статус сообщений сохраняется по умолчанию
+// (status.InProcessing), пустые ключ маршрутизации и контекст трассировки сохраняются как NULL. Временем сохранения
+// сообщения считается время его приема, а если оно не задано - текущее время. При ошибке не сохраняется ни одно
+// сообщение из пакета. Если включен транзакционный outbox, в той же транзакции для каждого сообщения создается запись
+// в таблице message_outbox для последующей отправки в брокер.
+func (p *PostgreSQL) SaveMessages(ctx context.Context, data []dto.MessageID) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(data))
+	args := make([]interface{}, 0, len(data)*7)
+	ids := make([]string, 0, len(data))
+	for _, record := range data {
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, NULLIF($%d, ''), NULLIF($%d, ''), NULLIF($%d, ''), "+
+			"COALESCE($%d::timestamptz::timestamp, now()))", len(args)+1, len(args)+2, len(args)+3, len(args)+4,
+			len(args)+5, len(args)+6, len(args)+7))
+
+		var createdAt interface{}
+		if !record.CreatedAt.IsZero() {
+			createdAt = record.CreatedAt
+		}
+		args = append(args, record.ID, record.Message, p.instance, record.IdempotencyKey, record.RoutingKey,
+			record.TraceParent, createdAt)
+		ids = append(ids, record.ID.String())
+	}
+
+	stmt := `INSERT INTO messages (id, message, instance, idempotency_key, routing_key, traceparent, created_at) 
+			values ` + strings.Join(values, ", ") + `;`
+
+	if !p.transactionalOutbox {
+		_, err := p.pool.ExecEx(ctx, stmt, nil, args...)
+		return saveError(err)
+	}
+
+	tx, err := p.pool.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.ExecEx(ctx, stmt, nil, args...); err != nil {
+		return saveError(err)
+	}
+
+	stmt = `INSERT INTO message_outbox (message_id, instance) SELECT unnest($1::uuid[]), $2;`
+	if _, err = tx.ExecEx(ctx, stmt, nil, ids, p.instance); err != nil {
+		return err
+	}
+
+	return tx.CommitEx(ctx)
+}
+
+// saveError преобразует ошибку нарушения уникальности при сохранении сообщений в repository.ErrDuplicateKeyValue.
+// Остальные ошибки возвращаются без изменений.
+func saveError(err error) error {
+	if err != nil && strings.HasPrefix(err.Error(), "ERROR: duplicate key value violates unique constraint") {
+		return repository.ErrDuplicateKeyValue
+	}
+
+	return err
+}
+
+// ClaimOutboxRecords закрепляет за текущим экземпляром приложения и возвращает в порядке сохранения не более limit
+// неотправленных в брокер сообщений из транзакционного outbox'а. Выбираются записи текущего экземпляра, а также записи
+// других экземпляров, не выбиравшиеся ими дольше claimTimeout (например, записи аварийно завершившегося экземпляра).
+// Выбираемые записи блокируются, поэтому одна запись не может быть закреплена несколькими экземплярами одновременно.
+func (p *PostgreSQL) ClaimOutboxRecords(ctx context.Context, limit int, claimTimeout time.Duration) (
+	[]dto.OutboxRecord, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	stmt := `WITH claimed AS (
+				UPDATE message_outbox SET instance = $1, claimed_at = now() 
+				WHERE id IN (
+					SELECT id FROM message_outbox 
+					WHERE instance = $1 OR COALESCE(claimed_at, created_at) < now() - $2::interval 
+					ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED
+				) 
+				RETURNING id, message_id
+			) 
+			SELECT c.id, m.id, m.message, m.attempts, COALESCE(m.routing_key, ''), COALESCE(m.traceparent, ''), 
+			m.created_at FROM claimed c JOIN messages m ON m.id = c.message_id ORDER BY c.id;`
+
+	rows, err := p.pool.QueryEx(ctx, stmt, nil, p.instance, claimTimeout, limit)
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "ERROR: duplicate key value violates unique constraint") {
-			return repository.ErrDuplicateKeyValue
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]dto.OutboxRecord, 0, limit)
+	for rows.Next() {
+		var record dto.OutboxRecord
+		if err = rows.Scan(&record.ID, &record.Data.ID, &record.Data.Message, &record.Data.Attempt,
+			&record.Data.RoutingKey, &record.Data.TraceParent, &record.Data.CreatedAt); err != nil {
+			return nil, err
 		}
+		result = append(result, record)
+	}
 
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// DeleteOutboxRecords удаляет отправленные в брокер записи транзакционного outbox'а с идентификаторами ids.
+func (p *PostgreSQL) DeleteOutboxRecords(ctx context.Context, ids []int64) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	stmt := `DELETE FROM message_outbox WHERE id = ANY($1);`
+	_, err := p.pool.ExecEx(ctx, stmt, nil, ids)
+
+	return err
+}
+
+// PendingOutboxCount возвращает количество неотправленных в брокер записей транзакционного outbox'а текущего
+// экземпляра приложения.
+func (p *PostgreSQL) PendingOutboxCount(ctx context.Context) (int, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	var count int
+	stmt := `SELECT COUNT(*) FROM message_outbox WHERE instance = $1;`
+	err := p.pool.QueryRowEx(ctx, stmt, nil, p.instance).Scan(&count)
+
+	return count, err
+}
+
+// UpdateStatus обновляет статус сообщения с идентификатором id на to, если текущий статус сообщения входит в from.
+// Вместе со статусом сохраняются код и описание ошибки обработки сообщения из details. Если сообщение отсутствует или
+// его текущий статус не входит в from, возвращается ошибка repository.ErrNotFound.
+func (p *PostgreSQL) UpdateStatus(ctx context.Context, id uuid.UUID, to status.Status, from []status.Status,
+	details dto.StatusDetails) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	stmt := `UPDATE messages SET status = $1, error_code = NULLIF($2, ''), error_reason = NULLIF($3, '') 
+			WHERE id = $4 AND status::text = ANY($5);`
+	tag, err := p.pool.ExecEx(ctx, stmt, nil, to, details.ErrorCode, details.Reason, id, statusesToStrings(from))
+	if err != nil {
 		return err
 	}
 
+	if tag.RowsAffected() == 0 {
+		return repository.ErrNotFound
+	}
+
 	return nil
 }
 
-// UpdateStatus статус сообщения с идентификатором id обновляется на status.Processed.
-func (p *PostgreSQL) UpdateStatus(ctx context.Context, id uuid.UUID) error {
-	stmt := `UPDATE messages SET status = $1 WHERE id = $2;`
-	_, err := p.pool.ExecEx(ctx, stmt, nil, status.Processed, id)
+// UpdateStatuses одним запросом обновляет статус сообщений с идентификаторами ids на to, если текущий статус
+// сообщения входит в from, и очищает код и описание ошибки обработки. Сообщения, отсутствующие в БД или находящиеся в
+// статусе, не входящем в from, не изменяются.
+func (p *PostgreSQL) UpdateStatuses(ctx context.Context, ids []uuid.UUID, to status.Status,
+	from []status.Status) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, id.String())
+	}
+
+	stmt := `UPDATE messages SET status = $1, error_code = NULL, error_reason = NULL 
+			WHERE id = ANY($2::uuid[]) AND status::text = ANY($3);`
+	_, err := p.pool.ExecEx(ctx, stmt, nil, to, values, statusesToStrings(from))
 
 	return err
 }
 
+// statusesToStrings преобразует срез статусов в срез строк для передачи в запрос в качестве массива.
+func statusesToStrings(statuses []status.Status) []string {
+	result := make([]string, 0, len(statuses))
+	for _, st := range statuses {
+		result = append(result, string(st))
+	}
+
+	return result
+}
+
 // ProcessedCount возвращает сумму обработанных сообщений за последний час, день, неделю, месяц.
 func (p *PostgreSQL) ProcessedCount(ctx context.Context) (dto.Processed, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
 	var (
 		result dto.Processed
 		rows   *pgx.Rows
@@ -186,3 +487,292 @@ func (p *PostgreSQL) ProcessedCount(ctx context.Context) (dto.Processed, error)
 
 	return result, nil
 }
+
+// MessageInfo возвращает метаданные и текущий статус сообщения с идентификатором id. Если сообщение отсутствует в БД,
+// возвращается ошибка repository.ErrNotFound.
+func (p *PostgreSQL) MessageInfo(ctx context.Context, id uuid.UUID) (dto.MessageInfo, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	result := dto.MessageInfo{ID: id, InRepository: true}
+
+	stmt := `SELECT octet_length(message), status::text, COALESCE(instance, ''), 
+				COALESCE(error_code, ''), COALESCE(error_reason, ''), created_at, updated_at,
+				EXISTS(SELECT 1 FROM message_outbox WHERE message_id = messages.id)
+			FROM messages WHERE id = $1;`
+
+	err := p.pool.QueryRowEx(ctx, stmt, nil, id).Scan(&result.Size, &result.Status, &result.Instance,
+		&result.ErrorCode, &result.Reason, &result.CreatedAt, &result.UpdatedAt, &result.InBrokerOutbox)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return dto.MessageInfo{}, repository.ErrNotFound
+		}
+
+		return dto.MessageInfo{}, err
+	}
+
+	return result, nil
+}
+
+// Messages возвращает метаданные сообщений, удовлетворяющих фильтру filter, упорядоченные по времени создания и
+// идентификатору. Выборка начинается после курсора filter.After (если он задан) и содержит не более filter.Limit
+// сообщений.
+func (p *PostgreSQL) Messages(ctx context.Context, filter dto.MessageFilter) ([]dto.MessageInfo, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	var (
+		conditions []string
+		args       []interface{}
+		rows       *pgx.Rows
+		err        error
+	)
+
+	addCondition := func(condition string, values ...interface{}) {
+		placeholders := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			args = append(args, value)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+
+	if len(filter.Status) > 0 {
+		addCondition("status = %s", filter.Status)
+	}
+	if len(filter.Instance) > 0 {
+		addCondition("instance = %s", filter.Instance)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		addCondition("created_at >= %s", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		addCondition("created_at < %s", filter.CreatedTo)
+	}
+	if !filter.UpdatedFrom.IsZero() {
+		addCondition("updated_at >= %s", filter.UpdatedFrom)
+	}
+	if !filter.UpdatedTo.IsZero() {
+		addCondition("updated_at < %s", filter.UpdatedTo)
+	}
+	if filter.After != nil {
+		addCondition("(created_at, id) > (%s, %s)", filter.After.CreatedAt, filter.After.ID)
+	}
+
+	stmt := `SELECT id, octet_length(message), status::text, COALESCE(instance, ''), 
+				COALESCE(error_code, ''), COALESCE(error_reason, ''), created_at, updated_at 
+			FROM messages`
+	if len(conditions) > 0 {
+		stmt += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	stmt += fmt.Sprintf(" ORDER BY created_at, id LIMIT $%d;", len(args))
+
+	rows, err = p.pool.QueryEx(ctx, stmt, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]dto.MessageInfo, 0, filter.Limit)
+	for rows.Next() {
+		info := dto.MessageInfo{InRepository: true}
+		if err = rows.Scan(&info.ID, &info.Size, &info.Status, &info.Instance, &info.ErrorCode, &info.Reason,
+			&info.CreatedAt, &info.UpdatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, info)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// MessageMetadata возвращает метаданные сообщений с идентификаторами ids, необходимые для их отправки в брокер.
+// Сообщения, отсутствующие в БД, в результат не попадают.
+func (p *PostgreSQL) MessageMetadata(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]dto.MessageMetadata, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	result := make(map[uuid.UUID]dto.MessageMetadata, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	strIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strIDs = append(strIDs, id.String())
+	}
+
+	stmt := `SELECT id, COALESCE(routing_key, ''), COALESCE(traceparent, ''), created_at, attempts FROM messages 
+			WHERE id = ANY($1::uuid[]);`
+
+	rows, err := p.pool.QueryEx(ctx, stmt, nil, strIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var metadata dto.MessageMetadata
+		if err = rows.Scan(&id, &metadata.RoutingKey, &metadata.TraceParent, &metadata.CreatedAt,
+			&metadata.Attempt); err != nil {
+			return nil, err
+		}
+		result[id] = metadata
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// IDByIdempotencyKey возвращает идентификатор сообщения, сохраненного с ключом идемпотентности key не ранее window
+// назад. Если сообщения с таким ключом нет, возвращается ошибка repository.ErrNotFound, если ключ принадлежит
+// сообщению, сохраненному ранее, чем window назад, - идентификатор этого сообщения и ошибка
+// repository.ErrIdempotencyKeyExpired.
+func (p *PostgreSQL) IDByIdempotencyKey(ctx context.Context, key string, window time.Duration) (uuid.UUID, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	var id uuid.UUID
+	var active bool
+
+	stmt := `SELECT id, created_at > now() - $2::interval FROM messages WHERE idempotency_key = $1;`
+
+	if err := p.pool.QueryRowEx(ctx, stmt, nil, key, window).Scan(&id, &active); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, repository.ErrNotFound
+		}
+
+		return uuid.Nil, err
+	}
+
+	if !active {
+		return id, repository.ErrIdempotencyKeyExpired
+	}
+
+	return id, nil
+}
+
+// ReleaseIdempotencyKey освобождает ключ идемпотентности key у сообщения, сохраненного ранее, чем window назад, чтобы
+// ключ можно было использовать повторно.
+func (p *PostgreSQL) ReleaseIdempotencyKey(ctx context.Context, key string, window time.Duration) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	stmt := `UPDATE messages SET idempotency_key = NULL WHERE idempotency_key = $1 AND created_at <= now() - $2::interval;`
+	_, err := p.pool.ExecEx(ctx, stmt, nil, key, window)
+
+	return err
+}
+
+// FailStuckMessages переводит в статус status.Failed сообщения, находящиеся в одном из статусов status.Stuck без
+// изменений дольше olderThan и уже отправленные повторно maxAttempts раз. Возвращает количество таких сообщений.
+func (p *PostgreSQL) FailStuckMessages(ctx context.Context, olderThan time.Duration, maxAttempts int) (int64, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	stmt := `UPDATE messages SET status = $1 
+			WHERE status::text = ANY($2) AND updated_at < now() - $3::interval AND attempts >= $4;`
+
+	tag, err := p.pool.ExecEx(ctx, stmt, nil, status.Failed, statusesToStrings(status.Stuck), olderThan, maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// RequeueDeadLettered переводит сообщение с идентификатором id из статуса status.DeadLettered в статус status.Queued,
+// увеличивает его счетчик попыток отправки и возвращает сообщение для повторной отправки в брокер. Если включен
+// транзакционный outbox, в том же запросе для сообщения создается запись outbox'а. Если сообщение отсутствует или его
+// статус отличается от status.DeadLettered, возвращается ошибка repository.ErrNotFound.
+func (p *PostgreSQL) RequeueDeadLettered(ctx context.Context, id uuid.UUID) (dto.MessageID, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	requeue := `UPDATE messages SET status = $1, attempts = attempts + 1 WHERE id = $2 AND status = $3 
+			RETURNING id, message, attempts, COALESCE(routing_key, '') AS routing_key, 
+				COALESCE(traceparent, '') AS traceparent, created_at`
+	args := []interface{}{status.Queued, id, status.DeadLettered}
+
+	stmt := requeue + `;`
+	if p.transactionalOutbox {
+		stmt = `WITH requeued AS (` + requeue + `), 
+				queued AS (INSERT INTO message_outbox (message_id, instance) SELECT id, $4 FROM requeued) 
+				SELECT id, message, attempts, routing_key, traceparent, created_at FROM requeued;`
+		args = append(args, p.instance)
+	}
+
+	var data dto.MessageID
+	err := p.pool.QueryRowEx(ctx, stmt, nil, args...).Scan(&data.ID, &data.Message, &data.Attempt, &data.RoutingKey,
+		&data.TraceParent, &data.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return dto.MessageID{}, repository.ErrNotFound
+		}
+
+		return dto.MessageID{}, err
+	}
+
+	return data, nil
+}
+
+// ClaimStuckMessages выбирает не более limit сообщений, находящихся в одном из статусов status.Stuck без изменений
+// дольше olderThan и отправленных повторно менее maxAttempts раз, увеличивает их счетчик попыток отправки и
+// возвращает их для повторной отправки в брокер. Выбранные сообщения блокируются, поэтому одно сообщение не может быть выбрано
+// несколькими экземплярами приложения одновременно. Если включен транзакционный outbox, для выбранных сообщений в том
+// же запросе создаются записи outbox'а. Сообщения, уже ожидающие отправки в транзакционном outbox'е, не выбираются.
+func (p *PostgreSQL) ClaimStuckMessages(ctx context.Context, olderThan time.Duration, maxAttempts, limit int) (
+	[]dto.MessageID, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	claim := `UPDATE messages SET attempts = attempts + 1 
+			WHERE id IN (
+				SELECT id FROM messages 
+				WHERE status::text = ANY($1) AND updated_at < now() - $2::interval AND attempts < $3 
+				AND NOT EXISTS (SELECT 1 FROM message_outbox o WHERE o.message_id = messages.id)
+				ORDER BY updated_at LIMIT $4 FOR UPDATE SKIP LOCKED
+			) 
+			RETURNING id, message, attempts, COALESCE(routing_key, '') AS routing_key, 
+				COALESCE(traceparent, '') AS traceparent, created_at`
+	args := []interface{}{statusesToStrings(status.Stuck), olderThan, maxAttempts, limit}
+
+	stmt := claim + `;`
+	if p.transactionalOutbox {
+		stmt = `WITH claimed AS (` + claim + `), 
+				queued AS (INSERT INTO message_outbox (message_id, instance) SELECT id, $5 FROM claimed) 
+				SELECT id, message, attempts, routing_key, traceparent, created_at FROM claimed;`
+		args = append(args, p.instance)
+	}
+
+	rows, err := p.pool.QueryEx(ctx, stmt, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]dto.MessageID, 0, limit)
+	for rows.Next() {
+		var data dto.MessageID
+		if err = rows.Scan(&data.ID, &data.Message, &data.Attempt, &data.RoutingKey, &data.TraceParent,
+			&data.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, data)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,40 @@
+/*
+Package retry: пакет содержит общую для зависимостей приложения (СУБД, Kafka) политику повторных попыток -
+экспоненциальную задержку со случайным разбросом и ограничением сверху, а также предохранитель (circuit breaker),
+который после серии неудачных обращений к зависимости на время прекращает обращения к ней.
+*/
+package retry
+
+import (
+	"github.com/lazylex/messaggio/internal/config"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff экспоненциальная задержка между повторными попытками.
+type Backoff struct {
+	initial    time.Duration // Задержка перед первой повторной попыткой
+	max        time.Duration // Максимальная задержка
+	multiplier float64       // Множитель, на который увеличивается задержка после каждой неудачной попытки
+	jitter     float64       // Доля задержки (от 0 до 1), на которую она случайным образом уменьшается
+}
+
+// NewBackoff возвращает экспоненциальную задержку, начинающуюся с initial, с параметрами роста из cfg. Если
+// максимальная задержка в cfg меньше initial, задержка не растет.
+func NewBackoff(initial time.Duration, cfg config.Retry) Backoff {
+	return Backoff{
+		initial:    initial,
+		max:        max(initial, cfg.RetryMaxInterval),
+		multiplier: max(1, cfg.RetryMultiplier),
+		jitter:     min(max(0, cfg.RetryJitter), 1),
+	}
+}
+
+// Delay возвращает задержку перед попыткой, следующей за failures неудачными попытками подряд.
+func (b Backoff) Delay(failures int) time.Duration {
+	d := float64(b.initial) * math.Pow(b.multiplier, float64(max(0, failures)))
+	d = min(d, float64(b.max))
+
+	return time.Duration(d * (1 - b.jitter*rand.Float64()))
+}
@@ -0,0 +1,113 @@
+package retry
+
+import (
+	"github.com/lazylex/messaggio/internal/config"
+	"testing"
+	"time"
+)
+
+// samples количество вычислений задержки для проверки границ случайного разброса.
+const samples = 1000
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		initial  time.Duration
+		cfg      config.Retry
+		failures int
+		min      time.Duration
+		max      time.Duration
+	}{
+		{
+			name:    "first attempt",
+			initial: 100 * time.Millisecond,
+			cfg:     config.Retry{RetryMaxInterval: time.Second, RetryMultiplier: 2},
+			min:     100 * time.Millisecond,
+			max:     100 * time.Millisecond,
+		},
+		{
+			name:     "negative failures",
+			initial:  100 * time.Millisecond,
+			cfg:      config.Retry{RetryMaxInterval: time.Second, RetryMultiplier: 2},
+			failures: -1,
+			min:      100 * time.Millisecond,
+			max:      100 * time.Millisecond,
+		},
+		{
+			name:     "exponential growth",
+			initial:  100 * time.Millisecond,
+			cfg:      config.Retry{RetryMaxInterval: time.Second, RetryMultiplier: 2},
+			failures: 3,
+			min:      800 * time.Millisecond,
+			max:      800 * time.Millisecond,
+		},
+		{
+			name:     "capped by max interval",
+			initial:  100 * time.Millisecond,
+			cfg:      config.Retry{RetryMaxInterval: time.Second, RetryMultiplier: 2},
+			failures: 10,
+			min:      time.Second,
+			max:      time.Second,
+		},
+		{
+			name:     "max interval below initial",
+			initial:  100 * time.Millisecond,
+			cfg:      config.Retry{RetryMaxInterval: time.Millisecond, RetryMultiplier: 2},
+			failures: 5,
+			min:      100 * time.Millisecond,
+			max:      100 * time.Millisecond,
+		},
+		{
+			name:     "multiplier below one",
+			initial:  100 * time.Millisecond,
+			cfg:      config.Retry{RetryMaxInterval: time.Second, RetryMultiplier: 0.5},
+			failures: 5,
+			min:      100 * time.Millisecond,
+			max:      100 * time.Millisecond,
+		},
+		{
+			name:     "jitter",
+			initial:  100 * time.Millisecond,
+			cfg:      config.Retry{RetryMaxInterval: time.Second, RetryMultiplier: 2, RetryJitter: 0.5},
+			failures: 2,
+			min:      200 * time.Millisecond,
+			max:      400 * time.Millisecond,
+		},
+		{
+			name:     "jitter above one",
+			initial:  100 * time.Millisecond,
+			cfg:      config.Retry{RetryMaxInterval: time.Second, RetryMultiplier: 2, RetryJitter: 2},
+			failures: 10,
+			min:      0,
+			max:      time.Second,
+		},
+		{
+			name:     "negative jitter",
+			initial:  100 * time.Millisecond,
+			cfg:      config.Retry{RetryMaxInterval: time.Second, RetryMultiplier: 2, RetryJitter: -1},
+			failures: 1,
+			min:      200 * time.Millisecond,
+			max:      200 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBackoff(tt.initial, tt.cfg)
+
+			distinct := make(map[time.Duration]struct{})
+			for i := 0; i < samples; i++ {
+				d := b.Delay(tt.failures)
+				if d < tt.min || d > tt.max {
+					t.Fatalf("expected delay in [%s, %s], got %s", tt.min, tt.max, d)
+				}
+				distinct[d] = struct{}{}
+			}
+
+			// при случайном разбросе задержки различаются, без него - совпадают
+			if spread := tt.min != tt.max; spread != (len(distinct) > 1) {
+				t.Fatalf("expected spread %t, got %d distinct delays", spread, len(distinct))
+			}
+		})
+	}
+}
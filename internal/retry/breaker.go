@@ -0,0 +1,171 @@
+package retry
+
+import (
+	"errors"
+	"github.com/lazylex/messaggio/internal/config"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("retry: circuit breaker is open")
+
+// State состояние предохранителя. Числовые значения используются в метриках.
+type State int
+
+const (
+	Closed   State = iota // Обращения к зависимости разрешены
+	HalfOpen              // Разрешены только пробные обращения
+	Open                  // Обращения к зависимости запрещены
+)
+
+// String возвращает название состояния.
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker предохранитель (circuit breaker) зависимости. После threshold неудачных обращений подряд размыкается и в
+// течение openTimeout запрещает обращения, после чего переходит в полуоткрытое состояние и разрешает не более probes
+// одновременных пробных обращений. Успешное пробное обращение замыкает предохранитель, неудачное - снова размыкает.
+type Breaker struct {
+	mu          sync.Mutex
+	name        string            // Название зависимости
+	state       State             // Текущее состояние
+	failures    int               // Количество неудачных обращений подряд
+	threshold   int               // Количество неудачных обращений подряд, после которого предохранитель размыкается
+	openTimeout time.Duration     // Время, в течение которого обращения запрещены
+	probes      int               // Максимальное количество одновременных пробных обращений
+	inFlight    int               // Количество выполняемых пробных обращений
+	changedAt   time.Time         // Время последней смены состояния или начала пробного обращения
+	onChange    func(state State) // Вызывается при смене состояния
+}
+
+// NewBreaker возвращает замкнутый предохранитель зависимости name с параметрами из cfg. onChange (может быть nil)
+// вызывается при каждой смене состояния, в том числе при создании.
+func NewBreaker(name string, cfg config.Retry, onChange func(state State)) *Breaker {
+	b := &Breaker{
+		name:        name,
+		threshold:   max(1, cfg.BreakerFailureThreshold),
+		openTimeout: cfg.BreakerOpenTimeout,
+		probes:      max(1, cfg.BreakerHalfOpenProbes),
+		changedAt:   time.Now(),
+		onChange:    onChange,
+	}
+
+	if onChange != nil {
+		onChange(Closed)
+	}
+
+	return b
+}
+
+// Name возвращает название зависимости.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State возвращает текущее состояние предохранителя.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Tripped возвращает true, если предохранитель разомкнут и время для пробных обращений еще не наступило. В отличие от
+// Allow не занимает пробное обращение.
+func (b *Breaker) Tripped() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == Open && time.Since(b.changedAt) < b.openTimeout
+}
+
+// Allow возвращает true, если обращение к зависимости разрешено. Получивший разрешение обязан сообщить результат
+// обращения вызовом Success, Failure или Release.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Closed:
+		return true
+	case Open:
+		if time.Since(b.changedAt) < b.openTimeout {
+			return false
+		}
+		b.setState(HalfOpen)
+	}
+
+	// пробное обращение, результат которого не был получен за openTimeout, считается потерянным
+	if b.inFlight >= b.probes && time.Since(b.changedAt) >= b.openTimeout {
+		b.inFlight = 0
+	}
+
+	if b.inFlight >= b.probes {
+		return false
+	}
+
+	b.inFlight++
+	b.changedAt = time.Now()
+
+	return true
+}
+
+// Success учитывает успешное обращение к зависимости и замыкает предохранитель.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.release()
+	if b.state != Closed {
+		b.setState(Closed)
+	}
+}
+
+// Failure учитывает неудачное обращение к зависимости. Размыкает предохранитель, если он находится в полуоткрытом
+// состоянии или количество неудачных обращений подряд достигло порога.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.release()
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.threshold) {
+		b.setState(Open)
+	}
+}
+
+// Release освобождает разрешение на обращение, результат которого не позволяет судить о доступности зависимости
+// (например, запрос был отменен клиентом).
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.release()
+}
+
+// release уменьшает количество выполняемых пробных обращений.
+func (b *Breaker) release() {
+	if b.state == HalfOpen && b.inFlight > 0 {
+		b.inFlight--
+	}
+}
+
+// setState меняет состояние предохранителя и вызывает onChange.
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.inFlight = 0
+	b.changedAt = time.Now()
+
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
@@ -0,0 +1,151 @@
+package retry
+
+import (
+	"github.com/lazylex/messaggio/internal/config"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Действия над предохранителем в шагах теста.
+const (
+	stepAllow   = "allow"
+	stepSuccess = "success"
+	stepFailure = "failure"
+	stepRelease = "release"
+	stepExpire  = "expire"
+)
+
+// step шаг теста предохранителя: действие и ожидаемый результат.
+type step struct {
+	action  string // Действие над предохранителем
+	allowed bool   // Ожидаемый результат Allow (для остальных действий не проверяется)
+	state   State  // Ожидаемое состояние после действия
+	tripped bool   // Ожидаемый результат Tripped после действия
+}
+
+func TestBreaker(t *testing.T) {
+	cfg := config.Retry{BreakerFailureThreshold: 2, BreakerOpenTimeout: time.Hour, BreakerHalfOpenProbes: 1}
+
+	tests := []struct {
+		name        string
+		steps       []step
+		transitions []State
+	}{
+		{
+			name: "closed below threshold",
+			steps: []step{
+				{action: stepAllow, allowed: true, state: Closed},
+				{action: stepFailure, state: Closed},
+				{action: stepAllow, allowed: true, state: Closed},
+			},
+			transitions: []State{Closed},
+		},
+		{
+			name: "success resets failures",
+			steps: []step{
+				{action: stepFailure, state: Closed},
+				{action: stepSuccess, state: Closed},
+				{action: stepFailure, state: Closed},
+			},
+			transitions: []State{Closed},
+		},
+		{
+			name: "opens at threshold",
+			steps: []step{
+				{action: stepFailure, state: Closed},
+				{action: stepFailure, state: Open, tripped: true},
+				{action: stepAllow, allowed: false, state: Open, tripped: true},
+			},
+			transitions: []State{Closed, Open},
+		},
+		{
+			name: "closed, open, half-open, closed",
+			steps: []step{
+				{action: stepFailure, state: Closed},
+				{action: stepFailure, state: Open, tripped: true},
+				{action: stepExpire, state: Open},
+				{action: stepAllow, allowed: true, state: HalfOpen},
+				{action: stepAllow, allowed: false, state: HalfOpen},
+				{action: stepSuccess, state: Closed},
+				{action: stepAllow, allowed: true, state: Closed},
+			},
+			transitions: []State{Closed, Open, HalfOpen, Closed},
+		},
+		{
+			name: "failed probe reopens",
+			steps: []step{
+				{action: stepFailure, state: Closed},
+				{action: stepFailure, state: Open, tripped: true},
+				{action: stepExpire, state: Open},
+				{action: stepAllow, allowed: true, state: HalfOpen},
+				{action: stepFailure, state: Open, tripped: true},
+				{action: stepAllow, allowed: false, state: Open, tripped: true},
+			},
+			transitions: []State{Closed, Open, HalfOpen, Open},
+		},
+		{
+			name: "released probe",
+			steps: []step{
+				{action: stepFailure, state: Closed},
+				{action: stepFailure, state: Open, tripped: true},
+				{action: stepExpire, state: Open},
+				{action: stepAllow, allowed: true, state: HalfOpen},
+				{action: stepRelease, state: HalfOpen},
+				{action: stepAllow, allowed: true, state: HalfOpen},
+			},
+			transitions: []State{Closed, Open, HalfOpen},
+		},
+		{
+			name: "lost probe",
+			steps: []step{
+				{action: stepFailure, state: Closed},
+				{action: stepFailure, state: Open, tripped: true},
+				{action: stepExpire, state: Open},
+				{action: stepAllow, allowed: true, state: HalfOpen},
+				{action: stepExpire, state: HalfOpen},
+				{action: stepAllow, allowed: true, state: HalfOpen},
+			},
+			transitions: []State{Closed, Open, HalfOpen},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var transitions []State
+			b := NewBreaker("test", cfg, func(state State) { transitions = append(transitions, state) })
+
+			for i, s := range tt.steps {
+				switch s.action {
+				case stepAllow:
+					if allowed := b.Allow(); allowed != s.allowed {
+						t.Fatalf("step %d: expected allowed %t, got %t", i, s.allowed, allowed)
+					}
+				case stepSuccess:
+					b.Success()
+				case stepFailure:
+					b.Failure()
+				case stepRelease:
+					b.Release()
+				case stepExpire:
+					// время размыкания или пробного обращения истекает
+					b.mu.Lock()
+					b.changedAt = b.changedAt.Add(-cfg.BreakerOpenTimeout)
+					b.mu.Unlock()
+				}
+
+				if state := b.State(); state != s.state {
+					t.Fatalf("step %d (%s): expected state %s, got %s", i, s.action, s.state, state)
+				}
+
+				if tripped := b.Tripped(); tripped != s.tripped {
+					t.Fatalf("step %d (%s): expected tripped %t, got %t", i, s.action, s.tripped, tripped)
+				}
+			}
+
+			if !slices.Equal(transitions, tt.transitions) {
+				t.Fatalf("expected transitions %v, got %v", tt.transitions, transitions)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"github.com/lazylex/messaggio/internal/retry"
+	"sync"
+	"time"
+)
+
+type lifecycle struct {
+	mu      sync.Mutex         // Защищает closing
+	closing bool               // Флаг, означающий, что сервис завершает работу и новые go-рутины не запускаются
+	workers sync.WaitGroup     // Запущенные сервисом go-рутины
+	stop    chan struct{}      // Закрывается в начале завершения работы для остановки периодических задач
+	ctx     context.Context    // Отменяется, когда время на завершение работы истекло
+	cancel  context.CancelFunc // Функция отмены ctx
+}
+
+// newLifecycle возвращает структуру для управления жизненным циклом go-рутин сервиса.
+func newLifecycle() lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return lifecycle{stop: make(chan struct{}), ctx: ctx, cancel: cancel}
+}
+
+// track запускает f в отдельной go-рутине, завершения которой дожидается Shutdown. Если сервис уже завершает работу,
+// f не запускается и возвращается false.
+func (s *Service) track(f func()) bool {
+	s.lifecycle.mu.Lock()
+	defer s.lifecycle.mu.Unlock()
+
+	if s.lifecycle.closing {
+		return false
+	}
+
+	s.lifecycle.workers.Add(1)
+	go func() {
+		defer s.lifecycle.workers.Done()
+		f()
+	}()
+
+	return true
+}
+
+// every запускает go-рутину, которая вызывает f каждые interval до начала завершения работы сервиса.
+func (s *Service) every(interval time.Duration, f func()) {
+	s.track(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.lifecycle.stop:
+				return
+			case <-ticker.C:
+				f()
+			}
+		}
+	})
+}
+
+// retrying запускает go-рутину, которая до начала завершения работы сервиса вызывает f с задержкой, определяемой
+// backoff: после успешного вызова (f вернула true) задержка сбрасывается до начальной, после неудачного - растет.
+func (s *Service) retrying(backoff retry.Backoff, f func() bool) {
+	s.track(func() {
+		failures := 0
+		for {
+			timer := time.NewTimer(backoff.Delay(failures))
+			select {
+			case <-s.lifecycle.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if f() {
+				failures = 0
+			} else {
+				failures++
+			}
+		}
+	})
+}
+
+// Shutdown завершает работу сервиса: останавливает периодические задачи (повторные попытки сохранения и отправки,
+// поиск зависших сообщений) и дожидается, пока сообщения, ожидающие отправки, будут переданы в канал для отправки в
+// брокер. Если ctx истекает раньше, оставшиеся сообщения сохраняются в outbox. После этого канал для отправки сообщений
+// закрывается. Возвращает ошибку ctx, если время на завершение работы истекло.
+func (s *Service) Shutdown(ctx context.Context) error {
+	var err error
+
+	s.lifecycle.mu.Lock()
+	if s.lifecycle.closing {
+		s.lifecycle.mu.Unlock()
+		return nil
+	}
+	s.lifecycle.closing = true
+	s.lifecycle.mu.Unlock()
+
+	close(s.lifecycle.stop)
+
+	done := make(chan struct{})
+	go func() {
+		s.lifecycle.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.lifecycle.cancel()
+		<-done
+	}
+
+	s.lifecycle.cancel()
+	close(s.messageChan)
+
+	return err
+}
@@ -2,14 +2,20 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/lazylex/messaggio/internal/config"
 	"github.com/lazylex/messaggio/internal/domain/value_objects/message"
+	"github.com/lazylex/messaggio/internal/domain/value_objects/status"
 	"github.com/lazylex/messaggio/internal/dto"
+	"github.com/lazylex/messaggio/internal/helpers/cursor"
+	"github.com/lazylex/messaggio/internal/helpers/tracecontext"
 	"github.com/lazylex/messaggio/internal/ports/metrics/service"
 	reo "github.com/lazylex/messaggio/internal/ports/record_outbox"
 	"github.com/lazylex/messaggio/internal/ports/repository"
 	srvc "github.com/lazylex/messaggio/internal/ports/service"
+	"github.com/lazylex/messaggio/internal/retry"
 	"log/slog"
 	"os"
 	"sync/atomic"
@@ -18,155 +24,653 @@ import (
 
 type Service struct {
 	repo                       repository.Interface     // Объект для взаимодействия с БД
-	messageChan                chan dto.MessageID       // Канал для отправки сообщений
+	messageChan                chan dto.MessageID       // Буферизованный канал для отправки сообщений
 	outbox                     outbox                   // Хранилище неотправленных данных
 	total                      atomic.Uint64            // Всего пришло сообщений на обработку
 	messagesSentToOutbox       atomic.Uint64            // Всего сохранено сообщений в outbox
 	messagesReturnedFromOutbox atomic.Uint64            // Всего удалось переместить сообщений из outbox в БД
-	canRetrySendToBroker       atomic.Bool              // Флаг, означающий, что запись в канал для отправки сообщений в kafka прошла успешно и есть смысл запускать go-рутину для последующих попыток отправки
+	statusesSentToOutbox       atomic.Uint64            // Всего сохранено в outbox обновлений статусов, не сохраненных в БД
 	metrics                    service.MetricsInterface // Метрики Prometheus
+	idempotencyWindow          time.Duration            // Время, в течение которого повторная отправка сообщения с тем же ключом идемпотентности не приводит к его повторной обработке
+	messagesResent             atomic.Uint64            // Всего повторно отправлено в брокер зависших сообщений
+	messagesFailed             atomic.Uint64            // Всего сообщений переведено в статус Failed
+	messagesDeadLettered       atomic.Uint64            // Всего сообщений переведено в статус DeadLettered
+	messagesRedriven           atomic.Uint64            // Всего повторно отправлено в брокер недоставленных сообщений
+	stuckThreshold             time.Duration            // Время без изменений, после которого сообщение в статусе InProcessing считается зависшим
+	maxResendAttempts          int                      // Количество повторных отправок зависшего сообщения, после которого оно переводится в статус Failed
+	sweepBatchSize             int                      // Количество зависших сообщений, выбираемых для повторной отправки за один запрос
+	lifecycle                  lifecycle                // Состояние go-рутин сервиса, используемое при завершении работы
+	retryBatchSize             int                      // Количество записей, выбираемых из outbox'а за одну попытку повторного сохранения/отправки
+	repoBreaker                *retry.Breaker           // Предохранитель СУБД
+	brokerBreaker              *retry.Breaker           // Предохранитель брокера сообщений
 }
 
 type outbox struct {
 	brokerRecord reo.Interface // Outbox для сохранения сообщений с ID, не отправленных в Kafka
 	repoRecord   reo.Interface // Outbox для сохранения сообщений с ID, не сохраненных в БД
+	statusRecord reo.Interface // Outbox для сохранения обновлений статусов сообщений, не сохраненных в БД
 }
 
-// MustCreate возвращает структуры для работы с сервисной логикой.
-func MustCreate(repo repository.Interface, brokerOutbox, repoOutbox reo.Interface,
-	cfg config.Service, metrics service.MetricsInterface) *Service {
-	if repo == nil || repoOutbox == nil || metrics == nil {
+// MustCreate возвращает структуры для работы с сервисной логикой. brokerOutbox может быть nil, если отправку сообщений
+// в брокер обеспечивает транзакционный outbox репозитория. Повторные попытки сохранения в БД и отправки в брокер
+// производятся с экспоненциально растущей (начиная с cfg.RetryTimeout) задержкой и предохранителями с параметрами из
+// retryCfg. Канал отправки сообщений в брокер вмещает cfg.MessageBufferSize сообщений, при заполненном буфере
+// отправитель ожидает, пока адаптер брокера не заберет сообщения из канала.
+func MustCreate(repo repository.Interface, brokerOutbox, repoOutbox, statusOutbox reo.Interface,
+	cfg config.Service, retryCfg config.Retry, metrics service.MetricsInterface) *Service {
+	if repo == nil || repoOutbox == nil || statusOutbox == nil || metrics == nil {
 		slog.Error("nil pointer in function parameters")
 		os.Exit(1)
 	}
 
-	messageChan := make(chan dto.MessageID)
+	if cfg.RetryBatchSize < 1 {
+		slog.Error("retry batch size must be positive")
+		os.Exit(1)
+	}
+
+	if cfg.MessageBufferSize < 0 {
+		slog.Error("message buffer size must not be negative")
+		os.Exit(1)
+	}
+
+	messageChan := make(chan dto.MessageID, cfg.MessageBufferSize)
 
 	s := &Service{messageChan: messageChan,
-		outbox:  outbox{repoRecord: repoOutbox, brokerRecord: brokerOutbox},
-		repo:    repo,
-		metrics: metrics,
+		outbox:            outbox{repoRecord: repoOutbox, brokerRecord: brokerOutbox, statusRecord: statusOutbox},
+		repo:              repo,
+		metrics:           metrics,
+		idempotencyWindow: cfg.IdempotencyWindow,
+		stuckThreshold:    cfg.StuckThreshold,
+		maxResendAttempts: cfg.MaxResendAttempts,
+		sweepBatchSize:    cfg.SweepBatchSize,
+		lifecycle:         newLifecycle(),
+		retryBatchSize:    cfg.RetryBatchSize,
+		repoBreaker:       newBreaker("postgresql", retryCfg, metrics),
+		brokerBreaker:     newBreaker("kafka", retryCfg, metrics),
 	}
 
-	s.canRetrySendToBroker.Store(true)
-	go func() {
-		for range time.Tick(cfg.RetryTimeout) {
-			go s.trySaveMessageAgain()
+	s.retrying(retry.NewBackoff(cfg.RetryTimeout, retryCfg), s.trySaveMessageAgain)
+	s.retrying(retry.NewBackoff(cfg.RetryTimeout, retryCfg), s.trySaveStatusAgain)
+	if s.outbox.brokerRecord != nil {
+		s.retrying(retry.NewBackoff(cfg.RetryTimeout, retryCfg), s.trySendToBrokerAgain)
+	}
 
-			if s.canRetrySendToBroker.Load() {
-				go s.trySendToBrokerAgain()
-			}
-		}
-	}()
+	if cfg.SweepInterval > 0 && cfg.SweepBatchSize > 0 {
+		s.startSweeper(cfg.SweepInterval)
+	}
 
 	return s
 }
 
+// newBreaker возвращает предохранитель зависимости name, состояние которого отражается в метриках.
+func newBreaker(name string, cfg config.Retry, metrics service.MetricsInterface) *retry.Breaker {
+	return retry.NewBreaker(name, cfg, func(state retry.State) { metrics.CircuitBreakerState(name, int(state)) })
+}
+
 // ProcessMessage сохраняет сообщение в БД, затем отправляет его в Kafka. При ошибке сохранения в БД или отправки
-// сообщения, оно сохраняется для последующих попыток записи в БД/отправки сообщения.
-func (s *Service) ProcessMessage(ctx context.Context, msg message.Message) (uuid.UUID, error) {
+// сообщения, оно сохраняется для последующих попыток записи в БД/отправки сообщения. Пока предохранитель СУБД или
+// брокера разомкнут, сообщение сразу сохраняется в соответствующий outbox. Если передан непустой ключ
+// идемпотентности idempotencyKey и сообщение с таким ключом уже было принято в течение окна идемпотентности, повторная
+// обработка не производится: возвращается идентификатор ранее принятого сообщения и ошибка srvc.ErrDuplicateRequest.
+// Ключ сообщения, принятого раньше окна идемпотентности, освобождается для повторного использования. Если проверить
+// ключ не удалось, сообщение не принимается и возвращается ошибка обращения к БД.
+// Непустой ключ маршрутизации routingKey сохраняется вместе с сообщением и используется в качестве ключа сообщения в
+// брокере, что обеспечивает попадание сообщений с одинаковым ключом в один раздел топика. Контекст трассировки,
+// сохраненный в ctx (см. tracecontext.NewContext), сохраняется вместе с сообщением и передается в брокер.
+// Если outbox для отправки в брокер заполнен, сообщение не принимается и возвращается ошибка
+// srvc.ErrBrokerOutboxFull, если при ошибке сохранения в БД заполнен outbox для повторной записи в БД -
+// srvc.ErrRepoOutboxFull.
+func (s *Service) ProcessMessage(ctx context.Context, msg message.Message, idempotencyKey, routingKey string) (
+	uuid.UUID, error) {
 	var err error
 
+	if len(idempotencyKey) > 0 {
+		originalID, errFind := s.repo.IDByIdempotencyKey(ctx, idempotencyKey, s.idempotencyWindow)
+		switch {
+		case errFind == nil:
+			return originalID, srvc.ErrDuplicateRequest
+		case errors.Is(errFind, repository.ErrIdempotencyKeyExpired):
+			if err = s.repo.ReleaseIdempotencyKey(ctx, idempotencyKey, s.idempotencyWindow); err != nil {
+				slog.Warn(err.Error())
+			}
+		case !errors.Is(errFind, repository.ErrNotFound):
+			return uuid.Nil, errFind
+		}
+	}
+
+	if err = s.CheckCapacity(); err != nil {
+		return uuid.Nil, err
+	}
+
 	id := uuid.New()
-	data := dto.MessageID{Message: msg, ID: id}
+	data := dto.MessageID{Message: msg, ID: id, IdempotencyKey: idempotencyKey, RoutingKey: routingKey,
+		TraceParent: traceParent(ctx), CreatedAt: time.Now().UTC()}
 
 	s.metrics.IncomingMsgInc()
 	s.total.Add(1)
 
-	if err = s.saveMessage(ctx, data); err != nil {
-		defer func() {
-			s.metrics.ProblemsSavingInDB()
-			if err := s.outbox.repoRecord.Add(data); err != nil {
-				slog.Error(err.Error())
-				return
+	if err = s.callRepo(func() error { return s.repo.SaveMessage(ctx, data) }); err != nil {
+		if errors.Is(err, repository.ErrDuplicateKeyValue) && len(idempotencyKey) > 0 {
+			originalID, errFind := s.repo.IDByIdempotencyKey(ctx, idempotencyKey, s.idempotencyWindow)
+			if errFind == nil {
+				return originalID, srvc.ErrDuplicateRequest
 			}
+			if !errors.Is(errFind, repository.ErrNotFound) && !errors.Is(errFind, repository.ErrIdempotencyKeyExpired) {
+				return uuid.Nil, errFind
+			}
+		}
 
-			s.messagesSentToOutbox.Add(1)
-		}()
+		s.metrics.ProblemsSavingInDB()
+		if err = s.outbox.repoRecord.Add(data); err != nil {
+			slog.Error(err.Error())
+			if errors.Is(err, reo.ErrOutboxFull) {
+				return uuid.Nil, srvc.ErrRepoOutboxFull
+			}
+			return id, srvc.ErrSavingToRepoRecordOutbox
+		}
+
+		s.messagesSentToOutbox.Add(1)
 
 		return id, srvc.ErrSavingToRepository
 	}
 
-	go func() {
-		if !s.outbox.brokerRecord.IsEmpty() {
-			if err = s.outbox.brokerRecord.Add(data); err != nil {
+	s.goSendToBroker(data)
+
+	return id, nil
+}
+
+// traceParent возвращает контекст трассировки, сохраненный в ctx, в формате заголовка traceparent или пустую строку,
+// если контекст не сохранен.
+func traceParent(ctx context.Context) string {
+	if tc, ok := tracecontext.FromContext(ctx); ok {
+		return tc.String()
+	}
+
+	return ""
+}
+
+// CheckCapacity возвращает ошибку srvc.ErrBrokerOutboxFull, если outbox для сообщений, не отправленных в брокер,
+// заполнен и доставка новых сообщений не может быть гарантирована.
+func (s *Service) CheckCapacity() error {
+	if s.outbox.brokerRecord != nil && s.outbox.brokerRecord.IsFull() {
+		return srvc.ErrBrokerOutboxFull
+	}
+
+	return nil
+}
+
+// ProcessMessages сохраняет пакет сообщений в БД одним запросом, затем отправляет их в Kafka. Пустые сообщения не
+// принимаются. При ошибке сохранения в БД сообщения сохраняются для последующих попыток записи. Возвращает результат
+// обработки каждого сообщения пакета в том же порядке.
+func (s *Service) ProcessMessages(ctx context.Context, msgs []message.Message) []dto.ProcessResult {
+	results := make([]dto.ProcessResult, len(msgs))
+	batch := make([]dto.MessageID, 0, len(msgs))
+	indexes := make([]int, 0, len(msgs))
+
+	for i, msg := range msgs {
+		results[i].Index = i
+		if len(msg) == 0 {
+			results[i].Status = srvc.ResultRejected
+			results[i].Error = srvc.ErrEmptyMessage.Error()
+			continue
+		}
+
+		data := dto.MessageID{Message: msg, ID: uuid.New(), TraceParent: traceParent(ctx), CreatedAt: time.Now().UTC()}
+		results[i].ID = uuid.NullUUID{UUID: data.ID, Valid: true}
+		batch = append(batch, data)
+		indexes = append(indexes, i)
+
+		s.metrics.IncomingMsgInc()
+		s.total.Add(1)
+	}
+
+	if err := s.callRepo(func() error { return s.repo.SaveMessages(ctx, batch) }); err != nil {
+		for i, data := range batch {
+			s.metrics.ProblemsSavingInDB()
+			results[indexes[i]].Status = srvc.ResultTemporallyNotSaved
+			if err = s.outbox.repoRecord.Add(data); err != nil {
 				slog.Error(err.Error())
+				results[indexes[i]].Error = srvc.ErrSavingToRepoRecordOutbox.Error()
+				if errors.Is(err, reo.ErrOutboxFull) {
+					results[indexes[i]].Status = srvc.ResultRejected
+					results[indexes[i]].Error = srvc.ErrRepoOutboxFull.Error()
+				}
+				continue
 			}
+
+			s.messagesSentToOutbox.Add(1)
+		}
+
+		return results
+	}
+
+	for i := range batch {
+		results[indexes[i]].Status = srvc.ResultSaved
+	}
+
+	for _, data := range batch {
+		s.goSendToBroker(data)
+	}
+
+	return results
+}
+
+// sendToBroker передает сообщение в канал для отправки в брокер сообщений. Если outbox с неотправленными сообщениями
+// не пуст, сообщение сохраняется в него, чтобы не нарушать очередность отправки. Пока предохранитель брокера
+// разомкнут, сообщение также сразу сохраняется в outbox. При отсутствии outbox'а для
+// неотправленных сообщений отправка осуществляется через транзакционный outbox репозитория и здесь не производится.
+func (s *Service) sendToBroker(data dto.MessageID) {
+	if s.outbox.brokerRecord == nil {
+		return
+	}
+
+	if !s.outbox.brokerRecord.IsEmpty() || s.brokerBreaker.Tripped() {
+		if err := s.outbox.brokerRecord.Add(data); err != nil {
+			slog.Error(err.Error())
 			return
 		}
+		s.markQueued(data.ID)
+		return
+	}
+
+	select {
+	case s.messageChan <- data:
+	case <-s.lifecycle.ctx.Done():
+		if err := s.SaveUnsentMessage(data); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
 
-		s.messageChan <- data
-	}()
+// goSendToBroker передает сообщение в канал для отправки в брокер в отдельной go-рутине. Если сервис завершает работу,
+// сообщение сразу сохраняется в outbox.
+func (s *Service) goSendToBroker(data dto.MessageID) {
+	if s.track(func() { s.sendToBroker(data) }) {
+		return
+	}
 
-	return id, nil
+	if err := s.SaveUnsentMessage(data); err != nil && !errors.Is(err, srvc.ErrNoBrokerRecordOutbox) {
+		slog.Error(err.Error())
+	}
 }
 
 // MarkMessageAsProcessed меняет статус в БД у сообщения на "Processed".
 func (s *Service) MarkMessageAsProcessed(ctx context.Context, id uuid.UUID) error {
-	if s.repo.UpdateStatus(ctx, id) == nil {
-		s.metrics.ProcessedMsgInc()
+	return s.ChangeStatus(ctx, id, status.Processed)
+}
+
+// ChangeStatus меняет статус сообщения с идентификатором id на target, если переход из текущего статуса сообщения в
+// target допустим. Повторная установка текущего статуса ошибкой не считается. При недопустимом переходе возвращает
+// ошибку srvc.ErrInvalidTransition, при отсутствии сообщения в БД - srvc.ErrMessageNotFound.
+func (s *Service) ChangeStatus(ctx context.Context, id uuid.UUID, target status.Status) error {
+	return s.changeStatus(ctx, id, target, dto.StatusDetails{})
+}
+
+// MarkSent одним запросом к БД меняет статус отправленных в брокер сообщений с идентификаторами ids на status.Sent.
+// Статус сообщений, для которых этот переход недопустим (например, подтверждение обработки уже получено), не
+// меняется.
+func (s *Service) MarkSent(ctx context.Context, ids []uuid.UUID) error {
+	if len(ids) == 0 {
 		return nil
 	}
 
-	return srvc.ErrUpdateStatusInRepository
+	err := s.callRepo(func() error { return s.repo.UpdateStatuses(ctx, ids, status.Sent, sourcesOf(status.Sent)) })
+	if err != nil {
+		slog.Error(err.Error())
+		return srvc.ErrUpdateStatusInRepository
+	}
+
+	return nil
+}
+
+// ConfirmMessage применяет полученное от получателя подтверждение обработки сообщения: меняет статус сообщения на
+// outcome (по правилам ChangeStatus), сохраняет код и описание ошибки обработки и учитывает подтверждение в метриках.
+func (s *Service) ConfirmMessage(ctx context.Context, id uuid.UUID, outcome status.Status, details dto.StatusDetails) error {
+	if err := s.changeStatus(ctx, id, outcome, details); err != nil {
+		return err
+	}
+
+	s.metrics.ConfirmationInc(string(outcome))
+
+	return nil
+}
+
+// changeStatus меняет статус сообщения на target, сохраняя details. Подробнее см. ChangeStatus.
+func (s *Service) changeStatus(ctx context.Context, id uuid.UUID, target status.Status, details dto.StatusDetails) error {
+	sources := sourcesOf(target)
+	if len(sources) == 0 {
+		return srvc.ErrInvalidStatus
+	}
+
+	err := s.callRepo(func() error { return s.repo.UpdateStatus(ctx, id, target, sources, details) })
+	if err == nil {
+		if target == status.Processed {
+			s.metrics.ProcessedMsgInc()
+		}
+		return nil
+	}
+
+	if !errors.Is(err, repository.ErrNotFound) {
+		slog.Error(err.Error())
+		return srvc.ErrUpdateStatusInRepository
+	}
+
+	info, err := s.repo.MessageInfo(ctx, id)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return srvc.ErrMessageNotFound
+	case err != nil:
+		slog.Error(err.Error())
+		return srvc.ErrUpdateStatusInRepository
+	case info.Status == target:
+		return nil
+	default:
+		return srvc.ErrInvalidTransition
+	}
+}
+
+// SaveStatusUpdate сохраняет в outbox обновление статуса сообщения, которое не удалось сохранить в БД, для последующих
+// попыток. Возвращает nil только после того, как обновление сохранено в outbox.
+func (s *Service) SaveStatusUpdate(update dto.StatusUpdate) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	// идентификатор записи не совпадает с идентификатором сообщения, так как для одного сообщения в outbox'е может
+	// находиться несколько обновлений статуса
+	if err = s.outbox.statusRecord.Add(dto.MessageID{ID: uuid.New(), Message: data}); err != nil {
+		return err
+	}
+
+	s.statusesSentToOutbox.Add(1)
+
+	return nil
+}
+
+// DeadLetterMessage меняет статус сообщения, переданного в топик недоставленных сообщений, на status.DeadLettered,
+// сохраняя код и описание причины, по которой сообщение не может быть доставлено. Ошибки - как у ChangeStatus.
+func (s *Service) DeadLetterMessage(ctx context.Context, id uuid.UUID, details dto.StatusDetails) error {
+	if err := s.changeStatus(ctx, id, status.DeadLettered, details); err != nil {
+		return err
+	}
+
+	s.messagesDeadLettered.Add(1)
+
+	return nil
+}
+
+// RedriveMessage повторно отправляет в брокер сообщение в статусе status.DeadLettered: переводит его в статус
+// status.Queued, увеличивает счетчик попыток отправки и передает сообщение на отправку (при использовании
+// транзакционного outbox'а отправку осуществляет relay). Если сообщение отсутствует в БД, возвращает ошибку
+// srvc.ErrMessageNotFound, если его статус отличается от status.DeadLettered - srvc.ErrNotDeadLettered.
+func (s *Service) RedriveMessage(ctx context.Context, id uuid.UUID) error {
+	var data dto.MessageID
+	err := s.callRepo(func() (err error) {
+		data, err = s.repo.RequeueDeadLettered(ctx, id)
+		return err
+	})
+
+	if errors.Is(err, repository.ErrNotFound) {
+		if _, err = s.repo.MessageInfo(ctx, id); errors.Is(err, repository.ErrNotFound) {
+			return srvc.ErrMessageNotFound
+		}
+		if err != nil {
+			slog.Error(err.Error())
+			return srvc.ErrUpdateStatusInRepository
+		}
+
+		return srvc.ErrNotDeadLettered
+	}
+
+	if err != nil {
+		slog.Error(err.Error())
+		return srvc.ErrUpdateStatusInRepository
+	}
+
+	s.messagesRedriven.Add(1)
+	s.goSendToBroker(data)
+
+	return nil
+}
+
+// markQueued меняет статус сообщения, сохраненного в outbox для повторной отправки в брокер, на "Queued".
+func (s *Service) markQueued(id uuid.UUID) {
+	err := s.ChangeStatus(context.Background(), id, status.Queued)
+	if err != nil && !errors.Is(err, srvc.ErrInvalidTransition) {
+		slog.Warn(err.Error(), slog.String("id", id.String()))
+	}
 }
 
 // SaveUnsentMessage сохраняет в outbox сообщение, которое не удалось отправить в брокер сообщений.
 func (s *Service) SaveUnsentMessage(data dto.MessageID) error {
-	return s.outbox.brokerRecord.Add(data)
+	if s.outbox.brokerRecord == nil {
+		return srvc.ErrNoBrokerRecordOutbox
+	}
+
+	if err := s.outbox.brokerRecord.Add(data); err != nil {
+		return err
+	}
+
+	s.markQueued(data.ID)
+
+	return nil
 }
 
-// trySaveMessageAgain рекурсивно пытается сохранить в БД сообщения, ранее сохраненные в outbox. Попытки осуществляются
-// пока outbox содержит элементы и сохранение не вызывает ошибку.
-func (s *Service) trySaveMessageAgain() {
-	var err error
-	ctx := context.Background()
+// trySaveMessageAgain пытается сохранить в БД сообщения, ранее сохраненные в outbox. Сообщения выбираются из outbox'а
+// пакетами по retryBatchSize и удаляются из него только после сохранения в БД, поэтому при аварийном завершении
+// приложения не теряются. Попытки осуществляются, пока outbox содержит элементы и сохранение не вызывает ошибку.
+// Возвращает false, если outbox не удалось опустошить из-за ошибки сохранения или разомкнутого предохранителя СУБД.
+func (s *Service) trySaveMessageAgain() bool {
+	ctx := s.lifecycle.ctx
+
+	for {
+		batch := s.outbox.repoRecord.PopBatch(s.retryBatchSize)
+		if len(batch) == 0 {
+			return true
+		}
 
-	if s.outbox.repoRecord.IsEmpty() {
-		return
+		err := s.callRepo(func() error { return s.repo.SaveMessages(ctx, batch) })
+		if err == nil {
+			s.messagesReturnedFromOutbox.Add(uint64(len(batch)))
+			ack(s.outbox.repoRecord, batch)
+			continue
+		}
+
+		if errors.Is(err, retry.ErrOpen) || s.repoBreaker.Tripped() {
+			nack(s.outbox.repoRecord, batch)
+			return false
+		}
+
+		// пакет не сохраняется целиком, если хотя бы одно сообщение уже было сохранено ранее, поэтому сообщения
+		// сохраняются по одному
+		if !s.saveOneByOne(ctx, batch) {
+			return false
+		}
 	}
+}
 
-	record := s.outbox.repoRecord.Pop()
-	if err = s.repo.SaveMessage(ctx, record); err == nil {
-		s.messagesReturnedFromOutbox.Add(1)
-		s.trySaveMessageAgain()
-	} else {
-		err = s.outbox.repoRecord.Add(record)
-		if err != nil {
+// saveOneByOne сохраняет в БД сообщения пакета по одному. Сохраненные сообщения, а также сообщения, которые уже были
+// сохранены ранее, удаляются из outbox'а. При другой ошибке сохранения оставшиеся сообщения возвращаются в начало
+// outbox'а и возвращается false.
+func (s *Service) saveOneByOne(ctx context.Context, batch []dto.MessageID) bool {
+	for i, record := range batch {
+		err := s.callRepo(func() error { return s.repo.SaveMessage(ctx, record) })
+		switch {
+		case err == nil:
+			s.messagesReturnedFromOutbox.Add(1)
+		case errors.Is(err, repository.ErrDuplicateKeyValue):
+			// сообщение уже сохранено либо ключ идемпотентности занят ранее принятым сообщением
+			slog.Warn(err.Error(), slog.String("id", record.ID.String()))
+		default:
 			slog.Error(err.Error())
+			nack(s.outbox.repoRecord, batch[i:])
+			return false
 		}
+
+		ack(s.outbox.repoRecord, batch[i:i+1])
 	}
+
+	return true
 }
 
-// trySendToBrokerAgain рекурсивно пытается отправить в брокер не отправленное ранее сообщение. Попытки осуществляются
-// пока outbox содержит элементы.
-func (s *Service) trySendToBrokerAgain() {
-	if s.outbox.brokerRecord.IsEmpty() {
-		return
+// trySaveStatusAgain пытается сохранить в БД обновления статусов сообщений, ранее сохраненные в outbox. Обновления
+// выбираются из outbox'а пакетами по retryBatchSize и удаляются из него после сохранения в БД. Обновления с
+// недопустимым переходом статуса, а также обновления статусов сообщений, отсутствующих и в БД, и в outbox'е для
+// сохранения в БД, отбрасываются. При ошибке сохранения оставшиеся обновления возвращаются в начало outbox'а и
+// возвращается false.
+func (s *Service) trySaveStatusAgain() bool {
+	ctx := s.lifecycle.ctx
+
+	for {
+		batch := s.outbox.statusRecord.PopBatch(s.retryBatchSize)
+		if len(batch) == 0 {
+			return true
+		}
+
+		for i, record := range batch {
+			var update dto.StatusUpdate
+			if err := json.Unmarshal(record.Message, &update); err != nil {
+				slog.Error(err.Error(), slog.String("record", record.ID.String()))
+				ack(s.outbox.statusRecord, batch[i:i+1])
+				continue
+			}
+
+			err := s.changeStatus(ctx, update.ID, update.Outcome, update.Details)
+			switch {
+			case err == nil:
+				s.metrics.ConfirmationInc(string(update.Outcome))
+			case errors.Is(err, srvc.ErrMessageNotFound) && s.outbox.repoRecord.Contains(update.ID):
+				// сообщение еще не сохранено в БД, обновление статуса будет сохранено после него
+				nack(s.outbox.statusRecord, batch[i:])
+				return false
+			case errors.Is(err, srvc.ErrUpdateStatusInRepository):
+				nack(s.outbox.statusRecord, batch[i:])
+				return false
+			default:
+				slog.Warn(err.Error(), slog.String("id", update.ID.String()),
+					slog.String("outcome", string(update.Outcome)))
+			}
+
+			ack(s.outbox.statusRecord, batch[i:i+1])
+		}
 	}
+}
 
-	data := s.outbox.brokerRecord.Pop()
-	s.canRetrySendToBroker.Store(false)
-	s.messageChan <- data
-	s.canRetrySendToBroker.Store(true)
+// trySendToBrokerAgain пытается отправить в брокер не отправленные ранее сообщения. Сообщения выбираются из outbox'а
+// пакетами по retryBatchSize и удаляются из него после передачи в канал для отправки. Попытки осуществляются, пока
+// outbox содержит элементы. Если сервис завершает работу, не переданные в канал сообщения возвращаются в начало
+// outbox'а. Метаданные сообщений (ключ маршрутизации, контекст трассировки и т.п.), отсутствующие в записях,
+// добавленных в outbox предыдущими версиями приложения, восстанавливаются из БД. Возвращает false, если отправка не
+// производилась из-за разомкнутого предохранителя брокера или ошибки получения метаданных либо была прервана.
+func (s *Service) trySendToBrokerAgain() bool {
+	for {
+		if s.brokerBreaker.Tripped() {
+			return false
+		}
 
-	s.trySendToBrokerAgain()
+		batch := s.outbox.brokerRecord.PopBatch(s.retryBatchSize)
+		if len(batch) == 0 {
+			return true
+		}
+
+		if err := s.restoreMetadata(s.lifecycle.ctx, batch); err != nil {
+			slog.Error(err.Error())
+			nack(s.outbox.brokerRecord, batch)
+			return false
+		}
+
+		for i, data := range batch {
+			select {
+			case s.messageChan <- data:
+				ack(s.outbox.brokerRecord, batch[i:i+1])
+			case <-s.lifecycle.ctx.Done():
+				nack(s.outbox.brokerRecord, batch[i:])
+				return false
+			}
+		}
+	}
 }
 
-// saveMessage сохраняет сообщение в БД. При ошибке сохранения записывает в outbox для дальнейших попыток сохранения.
-func (s *Service) saveMessage(ctx context.Context, data dto.MessageID) error {
-	var err error
+// restoreMetadata заполняет метаданные записей batch, не сохраненные outbox'ом (время приема не задано), значениями
+// из БД.
+func (s *Service) restoreMetadata(ctx context.Context, batch []dto.MessageID) error {
+	ids := make([]uuid.UUID, 0, len(batch))
+	for _, record := range batch {
+		if record.CreatedAt.IsZero() {
+			ids = append(ids, record.ID)
+		}
+	}
 
-	if err = s.repo.SaveMessage(ctx, data); err == nil {
+	if len(ids) == 0 {
 		return nil
 	}
 
-	if err = s.outbox.repoRecord.Add(data); err != nil {
-		slog.Error(srvc.ErrSavingToRepoRecordOutbox.Error())
+	var metadata map[uuid.UUID]dto.MessageMetadata
+	err := s.callRepo(func() error {
+		var errMetadata error
+		metadata, errMetadata = s.repo.MessageMetadata(ctx, ids)
+		return errMetadata
+	})
+	if err != nil {
 		return err
 	}
 
-	return srvc.ErrSavingToRepository
+	for i := range batch {
+		if m, ok := metadata[batch[i].ID]; ok {
+			batch[i].RoutingKey = m.RoutingKey
+			batch[i].TraceParent = m.TraceParent
+			batch[i].CreatedAt = m.CreatedAt
+			batch[i].Attempt = m.Attempt
+		}
+	}
+
+	return nil
+}
+
+// callRepo выполняет обращение к СУБД f, если его разрешает предохранитель СУБД, и сообщает предохранителю результат.
+// Нарушение уникальности и отсутствие записи сбоем СУБД не считаются, а результат отмененного клиентом запроса не
+// учитывается. При разомкнутом предохранителе возвращает ошибку retry.ErrOpen, не обращаясь к СУБД.
+func (s *Service) callRepo(f func() error) error {
+	if !s.repoBreaker.Allow() {
+		return retry.ErrOpen
+	}
+
+	err := f()
+	switch {
+	case err == nil, errors.Is(err, repository.ErrDuplicateKeyValue), errors.Is(err, repository.ErrNotFound):
+		s.repoBreaker.Success()
+	case errors.Is(err, context.Canceled):
+		s.repoBreaker.Release()
+	default:
+		s.repoBreaker.Failure()
+	}
+
+	return err
+}
+
+// ack удаляет из outbox'а выданные им записи records.
+func ack(outbox reo.Interface, records []dto.MessageID) {
+	if err := outbox.Ack(recordIDs(records)...); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+// nack возвращает в начало outbox'а выданные им записи records.
+func nack(outbox reo.Interface, records []dto.MessageID) {
+	if err := outbox.Nack(recordIDs(records)...); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+// recordIDs возвращает идентификаторы записей records.
+func recordIDs(records []dto.MessageID) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+
+	return ids
 }
 
 // ProcessedCountStatistic возвращает статистику по обработанным сообщениям (за последний час, день, неделю, месяц).
@@ -174,15 +678,75 @@ func (s *Service) ProcessedCountStatistic(ctx context.Context) (dto.Processed, e
 	return s.repo.ProcessedCount(ctx)
 }
 
+// MessageInfo возвращает метаданные и статус сообщения с идентификатором id, а также признаки его нахождения в outbox'ах.
+// Сообщению, еще не сохраненному в БД, присваивается статус status.InProcessing. Если сообщение не найдено ни в БД, ни в
+// outbox'ах, возвращается ошибка srvc.ErrMessageNotFound.
+func (s *Service) MessageInfo(ctx context.Context, id uuid.UUID) (dto.MessageInfo, error) {
+	info, err := s.repo.MessageInfo(ctx, id)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return dto.MessageInfo{}, err
+	}
+
+	info.ID = id
+	info.InRepoOutbox = s.outbox.repoRecord.Contains(id)
+	if s.outbox.brokerRecord != nil {
+		info.InBrokerOutbox = info.InBrokerOutbox || s.outbox.brokerRecord.Contains(id)
+	}
+
+	if !info.InRepository {
+		if !info.InRepoOutbox && !info.InBrokerOutbox {
+			return dto.MessageInfo{}, srvc.ErrMessageNotFound
+		}
+		info.Status = status.InProcessing
+	}
+
+	return info, nil
+}
+
+// Messages возвращает страницу с метаданными сообщений, удовлетворяющих фильтру filter, и курсор для получения
+// следующей страницы. Если страница последняя, курсор пустой.
+func (s *Service) Messages(ctx context.Context, filter dto.MessageFilter) (dto.MessageList, error) {
+	limit := filter.Limit
+	filter.Limit++
+
+	messages, err := s.repo.Messages(ctx, filter)
+	if err != nil {
+		return dto.MessageList{}, err
+	}
+
+	result := dto.MessageList{Messages: messages}
+	if len(messages) > limit {
+		result.Messages = messages[:limit]
+		last := result.Messages[limit-1]
+		result.NextCursor = cursor.Encode(dto.MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	return result, nil
+}
+
 // Statistic возвращает статистику.
 func (s *Service) Statistic() dto.Statistic {
 	return dto.Statistic{
 		Total:                      s.total.Load(),
 		MessagesSentToOutbox:       s.messagesSentToOutbox.Load(),
 		MessagesReturnedFromOutbox: s.messagesReturnedFromOutbox.Load(),
+		StatusesSentToOutbox:       s.statusesSentToOutbox.Load(),
+		MessagesResent:             s.messagesResent.Load(),
+		MessagesFailed:             s.messagesFailed.Load(),
+		MessagesDeadLettered:       s.messagesDeadLettered.Load(),
+		MessagesRedriven:           s.messagesRedriven.Load(),
+		CircuitBreakers: map[string]string{
+			s.repoBreaker.Name():   s.repoBreaker.State().String(),
+			s.brokerBreaker.Name(): s.brokerBreaker.State().String(),
+		},
 	}
 }
 
+// BrokerBreaker возвращает предохранитель брокера сообщений, результаты обращений к которому сообщает адаптер брокера.
+func (s *Service) BrokerBreaker() *retry.Breaker {
+	return s.brokerBreaker
+}
+
 // MessageChan возвращает канал, который будет служить для отправки сообщений в брокер сообщений.
 func (s *Service) MessageChan() chan dto.MessageID {
 	return s.messageChan
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/lazylex/messaggio/internal/dto"
+	"log/slog"
+	"time"
+)
+
+// startSweeper запускает go-рутину, которая каждые interval ищет сообщения, зависшие в одном из статусов status.Stuck
+// (не получившие подтверждения обработки), и отправляет их в брокер повторно.
+func (s *Service) startSweeper(interval time.Duration) {
+	s.every(interval, func() {
+		ctx, cancel := context.WithTimeout(s.lifecycle.ctx, interval)
+		s.sweep(ctx)
+		cancel()
+	})
+}
+
+// sweep переводит в статус Failed зависшие сообщения, исчерпавшие лимит повторных отправок, а остальные зависшие
+// сообщения отправляет в брокер повторно порциями по sweepBatchSize, пока такие сообщения не закончатся. Пока
+// разомкнут предохранитель брокера, сообщения не доставляются не по вине получателя, поэтому поиск зависших сообщений
+// не производится.
+func (s *Service) sweep(ctx context.Context) {
+	if s.brokerBreaker.Tripped() {
+		return
+	}
+
+	var failed int64
+	err := s.callRepo(func() error {
+		var errFail error
+		failed, errFail = s.repo.FailStuckMessages(ctx, s.stuckThreshold, s.maxResendAttempts)
+		return errFail
+	})
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	if failed > 0 {
+		s.messagesFailed.Add(uint64(failed))
+		slog.Warn(fmt.Sprintf("%d messages marked as failed after %d resend attempts", failed, s.maxResendAttempts))
+	}
+
+	for ctx.Err() == nil && !s.brokerBreaker.Tripped() {
+		var records []dto.MessageID
+		err = s.callRepo(func() error {
+			var errClaim error
+			records, errClaim = s.repo.ClaimStuckMessages(ctx, s.stuckThreshold, s.maxResendAttempts, s.sweepBatchSize)
+			return errClaim
+		})
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+
+		for _, data := range records {
+			s.sendToBroker(data)
+		}
+		s.messagesResent.Add(uint64(len(records)))
+
+		if len(records) < s.sweepBatchSize {
+			return
+		}
+	}
+}
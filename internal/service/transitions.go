@@ -0,0 +1,21 @@
+package service
+
+import "github.com/lazylex/messaggio/internal/domain/value_objects/status"
+
+// transitions содержит допустимые переходы между статусами сообщений: ключ - целевой статус, значение - статусы, из
+// которых в него можно перейти. Статусы Processed, Failed, Rejected и Expired являются конечными. Из статуса
+// DeadLettered сообщение выводится только повторной отправкой (см. Service.RedriveMessage).
+var transitions = map[status.Status][]status.Status{
+	status.Queued:       {status.InProcessing, status.Sent},
+	status.Sent:         {status.InProcessing, status.Queued},
+	status.Processed:    status.Pending,
+	status.Failed:       status.Pending,
+	status.Rejected:     status.Pending,
+	status.Expired:      status.Pending,
+	status.DeadLettered: status.Pending,
+}
+
+// sourcesOf возвращает статусы, из которых допустим переход в статус target.
+func sourcesOf(target status.Status) []status.Status {
+	return transitions[target]
+}